@@ -2,33 +2,15 @@ package api
 
 import (
 	"fmt"
-	"net/url"
-	"os"
 	"strconv"
 
-	"github.com/spf13/viper"
 	"gitlab.com/oraxpool/orax-cli/common"
+	"gitlab.com/oraxpool/orax-cli/config"
 	"gopkg.in/resty.v1"
 )
 
-var oraxAPIBaseURL string
-
 var log = common.GetLog()
 
-func init() {
-	// Override endpoint with env variable
-	if os.Getenv("ORAX_API_ENDPOINT") != "" {
-		_, err := url.ParseRequestURI(os.Getenv("ORAX_API_ENDPOINT"))
-		if err != nil {
-			log.Fatalf("Failed to parse ORAX_API_ENDPOINT: %s", err)
-		}
-		oraxAPIBaseURL = os.Getenv("ORAX_API_ENDPOINT")
-	} else if oraxAPIBaseURL == "" {
-		// If not set at build time fallback to local dev endpoint
-		oraxAPIBaseURL = "http://localhost:2666"
-	}
-}
-
 func RegisterUser(email string, password string, payoutAddress string) (*RegisterUserResult, error) {
 	resp, err := resty.R().
 		SetHeader("Content-Type", "application/json").
@@ -39,7 +21,7 @@ func RegisterUser(email string, password string, payoutAddress string) (*Registe
 		}).
 		SetError(&ApiError{}).
 		SetResult(&RegisterUserResult{}).
-		Post(oraxAPIBaseURL + "/user")
+		Post(config.APIEndpoint() + "/user")
 
 	if err != nil {
 		return nil, err
@@ -60,7 +42,7 @@ func Authenticate(id string, password string) (*AuthenticateResult, error) {
 		SetBasicAuth(id, password).
 		SetError(&ApiError{}).
 		SetResult(&AuthenticateResult{}).
-		Post(oraxAPIBaseURL + "/user/auth")
+		Post(config.APIEndpoint() + "/user/auth")
 
 	if err != nil {
 		return nil, err
@@ -75,15 +57,20 @@ func Authenticate(id string, password string) (*AuthenticateResult, error) {
 }
 
 func RegisterMiner(alias string) (*RegisterMinerResult, error) {
+	jwt, err := config.GetSecret("jwt")
+	if err != nil {
+		return nil, err
+	}
+
 	resp, err := resty.R().
 		SetHeader("Content-Type", "application/json").
-		SetAuthToken(viper.GetString("jwt")).
+		SetAuthToken(jwt).
 		SetBody(map[string]string{
 			"alias": alias,
 		}).
 		SetError(&ApiError{}).
 		SetResult(&RegisterMinerResult{}).
-		Post(oraxAPIBaseURL + "/miner")
+		Post(config.APIEndpoint() + "/miner")
 
 	if err != nil {
 		return nil, err
@@ -98,13 +85,18 @@ func RegisterMiner(alias string) (*RegisterMinerResult, error) {
 }
 
 func GetUserInfo(id string, height int, pageSize int) (*UserInfoResult, error) {
+	jwt, err := config.GetSecret("jwt")
+	if err != nil {
+		return nil, err
+	}
+
 	resp, err := resty.R().
-		SetAuthToken(viper.GetString("jwt")).
+		SetAuthToken(jwt).
 		SetQueryParam("height", strconv.Itoa(height)).
 		SetQueryParam("pageSize", strconv.Itoa(pageSize)).
 		SetError(&ApiError{}).
 		SetResult(&UserInfoResult{}).
-		Get(oraxAPIBaseURL + "/user/" + id)
+		Get(config.APIEndpoint() + "/user/" + id)
 
 	if err != nil {
 		return nil, err
@@ -127,3 +127,34 @@ func newOraxUser() (userID string, jwt string, err error) {
 
 	return user.ID, user.JWT, nil
 }
+
+func askPassphrase() (passphrase string, err error) {
+	prompt := promptui.Prompt{
+		Label: "Secrets passphrase",
+		Mask:  '*',
+		Validate: func(input string) error {
+			if input == "" {
+				return errors.New("Passphrase cannot be empty")
+			}
+			return nil
+		},
+	}
+
+	return prompt.Run()
+}
+
+func askPassphraseConfirmation(passphrase string) (err error) {
+	prompt := promptui.Prompt{
+		Label: "Passphrase Confirmation",
+		Mask:  '*',
+		Validate: func(input string) error {
+			if input != passphrase {
+				return errors.New("Passphrase confirmation does not match")
+			}
+			return nil
+		},
+	}
+
+	_, err = prompt.Run()
+	return err
+}
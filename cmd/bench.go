@@ -1,12 +1,15 @@
 package cmd
 
 import (
+	"context"
 	"crypto/rand"
 	"fmt"
-	"math"
+	"os"
 	"runtime"
+	"strconv"
 	"time"
 
+	"gitlab.com/oraxpool/orax-cli/common"
 	"gitlab.com/oraxpool/orax-cli/hash"
 	"gitlab.com/oraxpool/orax-cli/mining"
 
@@ -22,15 +25,25 @@ var benchCmd = &cobra.Command{
 		bench()
 	},
 }
-var duration time.Duration
+var (
+	duration    time.Duration
+	benchTarget string
+)
 
 func init() {
 	rootCmd.AddCommand(benchCmd)
 	benchCmd.Flags().DurationVarP(&duration, "duration", "d", 1*time.Minute, "Duration of the benchmark.")
 	benchCmd.Flags().IntVarP(&nbMiners, "nbminer", "n", runtime.NumCPU(), "Number of concurrent miners. Default to number of logical CPUs.")
+	benchCmd.Flags().StringVarP(&benchTarget, "target", "t", "fffff00000000000", "Share target (hex) used to evaluate the share finding rate.")
 }
 
 func bench() {
+	target, err := strconv.ParseUint(benchTarget, 16, 64)
+	if err != nil {
+		common.PrintError("Invalid target [%s]: %s\n", benchTarget, err)
+		os.Exit(1)
+	}
+
 	fmt.Printf("\nRunning benchmark for %s...\n\n", duration)
 
 	hash.InitLXR()
@@ -41,16 +54,38 @@ func bench() {
 	miner := mining.NewSuperMiner(nbMiners)
 
 	// Start miners
-	miner.Mine(oprHash, []byte{19, 89}, math.MaxUint64)
-	timer := time.NewTimer(duration)
-	<-timer.C
-	miningSession := miner.Stop()
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+	err = miner.Mine(ctx, oprHash, []byte{19, 89}, target)
+	if err != nil {
+		common.PrintError("%s\n", err)
+		os.Exit(1)
+	}
+	<-ctx.Done()
+
+	miningSession, err := miner.Stop()
+	if err != nil {
+		common.PrintError("%s\n", err)
+		os.Exit(1)
+	}
 
 	// Print results
 	fmt.Printf("\n===================\n")
 	fmt.Printf("Benchmarck results:\n")
 	fmt.Printf("===================\n")
+	fingerprint := common.GetFingerprint()
+	fmt.Printf("%-15s %s (%s)\n", "Hardware", fingerprint, fingerprint.ID())
 	fmt.Printf("%-15s %s\n", "Duration", miningSession.Duration)
 	fmt.Printf("%-15s %d\n", "Total hashes", miningSession.TotalOps)
-	fmt.Printf("%-15s %d hash/s\n", "Hash rate", uint64(float64(miningSession.TotalOps)/miningSession.Duration.Seconds()))
+	fmt.Printf("%-15s %d hash/s\n", "Hash rate", uint64(float64(miningSession.TotalOps)/miningSession.ActiveDuration.Seconds()))
+	fmt.Printf("%-15s %016x\n", "Target", target)
+	fmt.Printf("%-15s %016x\n", "Best difficulty", miningSession.BestDifficulty)
+	fmt.Printf("%-15s %d\n", "Shares found", miningSession.TotalShares)
+	fmt.Printf("%-15s %.1f\n", "Shares expected", miningSession.ExpectedShares())
+	if miningSession.TotalShares > 0 {
+		fmt.Printf("%-15s %s\n", "Distribution", miningSession.DifficultyDistribution())
+	}
+	if miningSession.UnderFinding() {
+		common.PrintError("\nFound far fewer shares than expected, the LXR hash table may be corrupted.\n")
+	}
 }
@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gitlab.com/oraxpool/orax-cli/common"
+	"gitlab.com/oraxpool/orax-cli/config"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Read and edit the config file",
+}
+
+var configPathCmd = &cobra.Command{
+	Use:   "path",
+	Short: "Print the path of the config file",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		viper.ReadInConfig()
+		if viper.ConfigFileUsed() != "" {
+			fmt.Println(viper.ConfigFileUsed())
+		} else {
+			fmt.Println(configFilePath)
+		}
+	},
+}
+
+var configListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the settings of the config file",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		readConfigOrExit()
+		listConfig()
+	},
+}
+
+var configGetCmd = &cobra.Command{
+	Use:   "get <key>",
+	Short: "Print the value of a setting",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		readConfigOrExit()
+		k, err := config.Lookup(args[0])
+		exitOnError(err)
+		value, _ := config.Get(k)
+		if k.Secret {
+			secret, err := config.GetSecret(k.Name)
+			exitOnError(err)
+			value = secret
+		}
+		if value != nil {
+			fmt.Println(strings.TrimPrefix(k.Format(value, showSecrets), "\n"))
+		}
+	},
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "Validate and save the value of a setting",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		readConfigOrExit()
+		k, err := config.Lookup(args[0])
+		exitOnError(err)
+		if k.Managed {
+			exitOnError(fmt.Errorf("[%s] is set by orax-cli itself", k.Name))
+		}
+		exitOnError(config.Set(k, args[1]))
+		common.PrintSuccess("[%s] saved\n", k.Name)
+	},
+}
+
+var configUnsetCmd = &cobra.Command{
+	Use:   "unset <key>",
+	Short: "Remove a setting from the config file",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		readConfigOrExit()
+		// Unknown keys can be removed to clean up the config file
+		if _, err := config.Lookup(args[0]); err != nil && !viper.IsSet(args[0]) {
+			exitOnError(err)
+		}
+		exitOnError(config.Unset(args[0]))
+		common.PrintSuccess("[%s] removed\n", args[0])
+	},
+}
+
+var (
+	showSecrets   bool
+	listAllConfig bool
+)
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configPathCmd, configListCmd, configGetCmd, configSetCmd, configUnsetCmd)
+	configListCmd.Flags().BoolVar(&showSecrets, "show-secrets", false, "Print secrets in clear.")
+	configListCmd.Flags().BoolVar(&listAllConfig, "all", false, "Also list the settings that aren't set.")
+	configGetCmd.Flags().BoolVar(&showSecrets, "show-secrets", false, "Print secrets in clear.")
+}
+
+func readConfigOrExit() {
+	if err := viper.ReadInConfig(); err != nil {
+		common.PrintError("Failed to read config: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func exitOnError(err error) {
+	if err != nil {
+		common.PrintError("%s\n", err)
+		os.Exit(1)
+	}
+}
+
+func listConfig() {
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetAutoWrapText(false)
+	table.SetHeader([]string{"Key", "Value", "Type", "Description"})
+
+	for _, k := range config.Keys() {
+		value, set := config.Get(k)
+		// Secrets of the store are listed without unlocking it
+		inStore := !set && k.Secret && viper.GetString("secrets_store") != ""
+		if !set && !inStore && !listAllConfig {
+			continue
+		}
+
+		display := ""
+		switch {
+		case k.Type == config.Structured && set:
+			display = "(see `orax-cli config get " + k.Name + "`)"
+		case value != nil:
+			display = k.Format(value, showSecrets)
+		}
+		if inStore {
+			display = "(" + viper.GetString("secrets_store") + " store)"
+		} else if !set {
+			display += " (default)"
+		}
+		table.Append([]string{k.Name, strings.TrimSpace(display), k.Type.String(), k.Description})
+	}
+	for _, key := range config.UnknownKeys() {
+		table.Append([]string{key, fmt.Sprint(viper.Get(key)), "", "Unknown setting"})
+	}
+
+	fmt.Printf("\nProfile: %s (available: %s)\n\n", config.Profile(), strings.Join(config.Profiles(), ", "))
+	table.Render()
+	fmt.Printf("\n")
+}
@@ -0,0 +1,286 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gitlab.com/oraxpool/orax-cli/common"
+	"gitlab.com/oraxpool/orax-cli/config"
+	"gitlab.com/oraxpool/orax-cli/hash"
+	"gitlab.com/oraxpool/orax-cli/state"
+)
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check the configuration and the environment of the miner",
+	Run: func(cmd *cobra.Command, args []string) {
+		if !doctor() {
+			os.Exit(1)
+		}
+	},
+}
+
+var dialTimeout time.Duration
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+	doctorCmd.Flags().DurationVar(&dialTimeout, "timeout", 5*time.Second, "Timeout of the reachability checks.")
+}
+
+type checkStatus int
+
+const (
+	checkOK checkStatus = iota
+	checkWarning
+	checkFailed
+)
+
+// checkResult is the outcome of a doctor check and how to fix it
+type checkResult struct {
+	name   string
+	status checkStatus
+	detail string
+	fix    string
+}
+
+// doctor runs all the checks and returns false if any failed
+func doctor() bool {
+	var results []checkResult
+	add := func(r checkResult) {
+		results = append(results, r)
+		printCheck(r)
+	}
+
+	fmt.Printf("\n")
+
+	configOK := checkConfigFile(add)
+	if configOK {
+		checkConfigPermissions(add)
+		checkStateFile(add)
+	}
+	if err := config.CheckEnv(); err != nil {
+		add(checkResult{name: "Environment", status: checkFailed, detail: err.Error(), fix: "Mount the secret file or fix its path"})
+	} else if configOK || config.GetString("miner_id") != "" {
+		checkMinerConfig(add)
+	}
+	checkEndpoints(add)
+	checkMemory(add)
+
+	failed := 0
+	warnings := 0
+	for _, r := range results {
+		switch r.status {
+		case checkFailed:
+			failed++
+		case checkWarning:
+			warnings++
+		}
+	}
+
+	fmt.Printf("\n")
+	if failed > 0 {
+		common.PrintError("%d check(s) failed, %d warning(s)\n\n", failed, warnings)
+		return false
+	}
+	common.PrintSuccess("All checks passed, %d warning(s)\n\n", warnings)
+	return true
+}
+
+func printCheck(r checkResult) {
+	switch r.status {
+	case checkOK:
+		common.PrintSuccess("[ OK ] ")
+	case checkWarning:
+		fmt.Printf("[WARN] ")
+	case checkFailed:
+		common.PrintError("[FAIL] ")
+	}
+	fmt.Printf("%s: %s\n", r.name, r.detail)
+	if r.fix != "" && r.status != checkOK {
+		fmt.Printf("       Fix: %s\n", r.fix)
+	}
+}
+
+func checkConfigFile(add func(checkResult)) bool {
+	err := viper.ReadInConfig()
+	_, notFound := err.(viper.ConfigFileNotFoundError)
+	if (notFound || os.IsNotExist(err)) && config.GetString("miner_id") != "" {
+		add(checkResult{
+			name:   "Config file",
+			status: checkWarning,
+			detail: "No config file, the miner identity is read from the environment",
+			fix:    "Hash rates and the session history won't be saved",
+		})
+		return false
+	}
+	if err != nil {
+		add(checkResult{
+			name:   "Config file",
+			status: checkFailed,
+			detail: err.Error(),
+			fix:    fmt.Sprintf("Check the YAML syntax of [%s] or register with `orax-cli register`", configFilePath),
+		})
+		return false
+	}
+	add(checkResult{name: "Config file", detail: viper.ConfigFileUsed()})
+	return true
+}
+
+func checkConfigPermissions(add func(checkResult)) {
+	path := viper.ConfigFileUsed()
+	if runtime.GOOS == "windows" {
+		return
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		add(checkResult{name: "Config permissions", status: checkFailed, detail: err.Error()})
+		return
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		add(checkResult{
+			name:   "Config permissions",
+			status: checkWarning,
+			detail: fmt.Sprintf("%s is accessible by other users, it contains the miner secret", info.Mode().Perm()),
+			fix:    fmt.Sprintf("chmod 600 %s", path),
+		})
+		return
+	}
+	add(checkResult{name: "Config permissions", detail: info.Mode().Perm().String()})
+}
+
+func checkStateFile(add func(checkResult)) {
+	exists, err := state.Check()
+	switch {
+	case err != nil:
+		add(checkResult{
+			name:   "State file",
+			status: checkWarning,
+			detail: err.Error(),
+			fix:    fmt.Sprintf("Set %s to a writable path, hash rates and the login are only kept in memory", state.PathEnv),
+		})
+	case exists:
+		add(checkResult{name: "State file", detail: state.Path()})
+	default:
+		add(checkResult{name: "State file", detail: state.Path() + " (created when mining or logging in)"})
+	}
+
+	if legacy := config.LegacyStateKeys(); len(legacy) > 0 {
+		add(checkResult{
+			name:   "Legacy state",
+			status: checkWarning,
+			detail: fmt.Sprintf("%s of the config file are now kept in the state file", strings.Join(legacy, ", ")),
+			fix:    "Remove them from the config file",
+		})
+	}
+}
+
+func checkMinerConfig(add func(checkResult)) {
+	identities, err := loadMinerIdentities()
+	if err != nil {
+		add(checkResult{name: "Miners", status: checkFailed, detail: err.Error(), fix: "Fix the `miners` list of the config file"})
+	} else if len(identities) == 1 && (identities[0].MinerID == "" || identities[0].MinerSecret == "") {
+		add(checkResult{
+			name:   "Miners",
+			status: checkFailed,
+			detail: "miner_id or miner_secret is missing",
+			fix:    "Register the miner with `orax-cli register`",
+		})
+	} else {
+		add(checkResult{name: "Miners", detail: fmt.Sprintf("%d miner(s) configured", len(identities))})
+	}
+
+	if _, err := loadSchedule(); err != nil {
+		add(checkResult{name: "Schedule", status: checkFailed, detail: err.Error(), fix: "Fix the `schedule` section of the config file"})
+	}
+}
+
+func checkEndpoints(add func(checkResult)) {
+	if err := config.CheckProfile(); err != nil {
+		add(checkResult{name: "Profile", status: checkFailed, detail: err.Error(), fix: "Select an existing profile with --profile or ORAX_PROFILE"})
+		return
+	}
+	add(checkResult{name: "Profile", detail: config.Profile()})
+
+	checkEndpoint(add, "API endpoint", config.APIEndpoint(), "http", "https")
+	checkEndpoint(add, "Orchestrator endpoint", config.OrchestratorEndpoint(), "ws", "wss")
+
+	identities, err := loadMinerIdentities()
+	if err != nil {
+		return
+	}
+	for _, identity := range identities {
+		if identity.Endpoint != "" {
+			checkEndpoint(add, fmt.Sprintf("Orchestrator endpoint of [%s]", identity.Name), identity.Endpoint, "ws", "wss")
+		}
+	}
+}
+
+// checkEndpoint verifies the URL parses and its host accepts TCP connections
+func checkEndpoint(add func(checkResult), name string, endpoint string, schemes ...string) {
+	u, err := url.ParseRequestURI(endpoint)
+	if err != nil {
+		add(checkResult{name: name, status: checkFailed, detail: err.Error(), fix: "Set a valid URL such as " + schemes[0] + "://host:port"})
+		return
+	}
+	port := u.Port()
+	switch {
+	case u.Scheme == schemes[0] && port == "":
+		port = "80"
+	case u.Scheme == schemes[1] && port == "":
+		port = "443"
+	case u.Scheme != schemes[0] && u.Scheme != schemes[1]:
+		add(checkResult{
+			name:   name,
+			status: checkFailed,
+			detail: fmt.Sprintf("Unsupported scheme [%s] in %s", u.Scheme, endpoint),
+			fix:    fmt.Sprintf("Use a %s:// or %s:// URL", schemes[0], schemes[1]),
+		})
+		return
+	}
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(u.Hostname(), port), dialTimeout)
+	if err != nil {
+		add(checkResult{
+			name:   name,
+			status: checkFailed,
+			detail: fmt.Sprintf("%s is unreachable: %s", endpoint, err),
+			fix:    "Check the network connection, the proxy and firewall settings, and the endpoint",
+		})
+		return
+	}
+	conn.Close()
+	add(checkResult{name: name, detail: endpoint + " is reachable"})
+}
+
+func checkMemory(add func(checkResult)) {
+	required := uint64(1) << hash.MapSizeBits
+	available, ok := common.AvailableMemory()
+	if !ok {
+		add(checkResult{
+			name:   "Memory",
+			status: checkWarning,
+			detail: "Cannot determine the available memory on this system",
+			fix:    fmt.Sprintf("Make sure at least %s are available for the LXR table", humanize.IBytes(required)),
+		})
+		return
+	}
+	if available < required {
+		add(checkResult{
+			name:   "Memory",
+			status: checkFailed,
+			detail: fmt.Sprintf("%s available, the LXR table needs %s", humanize.IBytes(available), humanize.IBytes(required)),
+			fix:    "Stop other programs or mine on a machine with more memory",
+		})
+		return
+	}
+	add(checkResult{name: "Memory", detail: fmt.Sprintf("%s available, the LXR table needs %s", humanize.IBytes(available), humanize.IBytes(required))})
+}
@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/oraxpool/orax-cli/state"
+)
+
+// collect returns the add function of the checks and their results
+func collect() (func(checkResult), *[]checkResult) {
+	var results []checkResult
+	return func(r checkResult) { results = append(results, r) }, &results
+}
+
+func TestCheckStateFile(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "doctor")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state.json")
+	os.Setenv(state.PathEnv, path)
+	defer os.Unsetenv(state.PathEnv)
+
+	// The state file isn't created by the check
+	add, results := collect()
+	checkStateFile(add)
+	require.Len(*results, 1)
+	require.Equal(checkOK, (*results)[0].status)
+	require.Contains((*results)[0].detail, "created when mining")
+	_, err = os.Stat(path)
+	require.True(os.IsNotExist(err))
+
+	require.NoError(ioutil.WriteFile(path, []byte(`{"hashRates":{}}`), 0600))
+	add, results = collect()
+	checkStateFile(add)
+	require.Equal(checkResult{name: "State file", detail: path}, (*results)[0])
+
+	// nor repaired
+	require.NoError(ioutil.WriteFile(path, []byte(`{"hashRa`), 0600))
+	add, results = collect()
+	checkStateFile(add)
+	require.Equal(checkWarning, (*results)[0].status)
+	require.Contains((*results)[0].detail, "Corrupted")
+	raw, err := ioutil.ReadFile(path)
+	require.NoError(err)
+	require.Equal(`{"hashRa`, string(raw))
+
+	if os.Geteuid() != 0 {
+		require.NoError(os.Remove(path))
+		require.NoError(os.Chmod(dir, 0500))
+		defer os.Chmod(dir, 0700)
+		add, results = collect()
+		checkStateFile(add)
+		require.Equal(checkWarning, (*results)[0].status)
+		require.Contains((*results)[0].detail, "Cannot save the state")
+	}
+}
+
+func TestCheckLegacyState(t *testing.T) {
+	require := require.New(t)
+
+	os.Setenv(state.PathEnv, filepath.Join(os.TempDir(), "orax-doctor-missing", "state.json"))
+	defer os.Unsetenv(state.PathEnv)
+	viper.Set("jwt", "legacy")
+	viper.Set("hash_rate_4", 40000)
+	viper.Set("hash_rate_history_4", []map[string]interface{}{{"time": 1, "hash_rate": 40000, "duration": 60}})
+	defer viper.Reset()
+
+	add, results := collect()
+	checkStateFile(add)
+	require.Len(*results, 2)
+	require.Equal("Legacy state", (*results)[1].name)
+	require.Equal(checkWarning, (*results)[1].status)
+	require.Equal("jwt, hash_rate_4, hash_rate_history_4 of the config file are now kept in the state file", (*results)[1].detail)
+}
+
+func TestCheckConfigPermissions(t *testing.T) {
+	require := require.New(t)
+
+	f, err := ioutil.TempFile("", "config*.yml")
+	require.NoError(err)
+	f.Close()
+	defer os.Remove(f.Name())
+	viper.SetConfigFile(f.Name())
+	defer viper.Reset()
+
+	require.NoError(os.Chmod(f.Name(), 0644))
+	add, results := collect()
+	checkConfigPermissions(add)
+	require.Equal(checkWarning, (*results)[0].status)
+	require.Equal("chmod 600 "+f.Name(), (*results)[0].fix)
+
+	require.NoError(os.Chmod(f.Name(), 0600))
+	add, results = collect()
+	checkConfigPermissions(add)
+	require.Equal(checkOK, (*results)[0].status)
+}
+
+func TestCheckEndpoint(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	reachable := listener.Addr().String()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	unreachable := closed.Addr().String()
+	closed.Close()
+	defer listener.Close()
+	dialTimeout = time.Second
+
+	tests := []struct {
+		endpoint string
+		status   checkStatus
+		detail   string
+	}{
+		{"ws://" + reachable + "/miner", checkOK, "is reachable"},
+		{"ws://" + unreachable, checkFailed, "is unreachable"},
+		{"http://" + reachable, checkFailed, "Unsupported scheme [http]"},
+		{"orchestrator", checkFailed, "invalid URI"},
+	}
+	for _, test := range tests {
+		t.Run(test.endpoint, func(t *testing.T) {
+			add, results := collect()
+			checkEndpoint(add, "Orchestrator endpoint", test.endpoint, "ws", "wss")
+			require.Len(t, *results, 1)
+			require.Equal(t, test.status, (*results)[0].status)
+			require.True(t, strings.Contains((*results)[0].detail, test.detail), (*results)[0].detail)
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gitlab.com/oraxpool/orax-cli/common"
+)
+
+var hashRateCmd = &cobra.Command{
+	Use:   "hashrate",
+	Short: "Show the hash rates recorded to estimate the indicative hash rate",
+	Run: func(cmd *cobra.Command, args []string) {
+		viper.ReadInConfig()
+		printHashRates()
+	},
+}
+
+var hashRateNbMiners int
+
+func init() {
+	rootCmd.AddCommand(hashRateCmd)
+	hashRateCmd.Flags().IntVarP(&hashRateNbMiners, "nbminer", "n", 0, "Only show the history of this number of miners. 0 to show all.")
+}
+
+func printHashRates() {
+	counts := common.HashRateHistoryMinerCounts()
+	if hashRateNbMiners > 0 {
+		counts = []int{hashRateNbMiners}
+	}
+
+	fingerprint := common.GetFingerprint()
+	fmt.Printf("\nHardware: %s (%s)\n", fingerprint, fingerprint.ID())
+
+	printed := false
+	for _, n := range counts {
+		samples := common.GetHashRateHistory(n)
+		if len(samples) == 0 {
+			continue
+		}
+		printed = true
+
+		fmt.Printf("\n%d miners: indicative hash rate %s hash/s\n\n", n, humanize.Comma(common.GetIndicativeHashRate(n)))
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetAlignment(tablewriter.ALIGN_RIGHT)
+		table.SetHeader([]string{"Date", "Duration", "Hash rate"})
+		for _, s := range samples {
+			// Hash rates migrated from hash_rate_<n> have no session
+			date, duration := "-", "-"
+			if s.Time != 0 {
+				date = time.Unix(s.Time, 0).Local().Format("2006-01-02 15:04:05")
+				duration = time.Duration(s.Duration * float64(time.Second)).Round(time.Second).String()
+			}
+			table.Append([]string{date, duration, humanize.Comma(s.HashRate)})
+		}
+		table.Render()
+	}
+
+	if !printed {
+		fmt.Printf("\nNo hash rate recorded yet\n")
+	}
+	fmt.Printf("\n")
+}
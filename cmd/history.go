@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gitlab.com/oraxpool/orax-cli/common"
+	"gitlab.com/oraxpool/orax-cli/history"
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "List and summarize past mining sessions",
+	Run: func(cmd *cobra.Command, args []string) {
+		viper.ReadInConfig()
+		err := printHistory()
+		if err != nil {
+			common.PrintError("%s\n", err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+var (
+	historySince   string
+	historyUntil   string
+	historyLimit   int
+	historySummary bool
+	historyMiner   string
+)
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+	historyCmd.Flags().StringVar(&historySince, "since", "", "Only sessions started after this date (2006-01-02, RFC3339) or duration ago (24h).")
+	historyCmd.Flags().StringVar(&historyUntil, "until", "", "Only sessions started before this date (2006-01-02, RFC3339) or duration ago (24h).")
+	historyCmd.Flags().IntVarP(&historyLimit, "limit", "l", 20, "Number of most recent sessions to list. 0 to list all.")
+	historyCmd.Flags().BoolVar(&historySummary, "summary", false, "Only print the summary.")
+	historyCmd.Flags().StringVar(&historyMiner, "miner", "", "Only sessions of this miner, by ID or name in the `miners` list.")
+}
+
+func printHistory() error {
+	since, err := parseTimeFlag(historySince)
+	if err != nil {
+		return fmt.Errorf("Invalid --since: %s", err)
+	}
+	until, err := parseTimeFlag(historyUntil)
+	if err != nil {
+		return fmt.Errorf("Invalid --until: %s", err)
+	}
+
+	sessions, err := history.Read(history.Filter{Since: since, Until: until, MinerID: historyMinerID()})
+	if err != nil {
+		return err
+	}
+	if len(sessions) == 0 {
+		fmt.Printf("\nNo mining session recorded in [%s]\n\n", history.Path())
+		return nil
+	}
+
+	if !historySummary {
+		listed := history.Latest(sessions, historyLimit)
+
+		fmt.Printf("\nSessions:\n\n")
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetAlignment(tablewriter.ALIGN_RIGHT)
+		table.SetHeader([]string{"Start", "Duration", "Active", "OPR hash", "Target", "Hash rate", "Found", "Sent", "Send failures", "Accepted", "Rejected", "Stale"})
+		for _, s := range listed {
+			table.Append([]string{
+				s.StartTime.Local().Format("2006-01-02 15:04:05"),
+				s.Duration().Round(time.Second).String(),
+				s.ActiveDuration().Round(time.Second).String(),
+				abbreviate(s.OprHash),
+				fmt.Sprintf("%016x", s.Target),
+				humanize.Comma(s.HashRate()),
+				humanize.Comma(s.SharesFound),
+				humanize.Comma(s.SharesSent),
+				humanize.Comma(s.SendFailures),
+				humanize.Comma(s.SharesAccepted),
+				humanize.Comma(s.SharesRejected),
+				humanize.Comma(s.SharesStale),
+			})
+		}
+		table.Render()
+	}
+
+	summary := history.Summarize(sessions)
+	fmt.Printf("\nSummary:\n\n")
+	fmt.Printf("%-22s %s\n", "First session", summary.First.Local().Format(time.RFC3339))
+	fmt.Printf("%-22s %s\n", "Last session", summary.Last.Local().Format(time.RFC3339))
+	fmt.Printf("%-22s %d\n", "Sessions", summary.Sessions)
+	fmt.Printf("%-22s %s\n", "Session time", summary.Duration.Round(time.Second))
+	fmt.Printf("%-22s %s\n", "Active mining time", summary.ActiveDuration.Round(time.Second))
+	fmt.Printf("%-22s %s\n", "Total hashes", humanize.Comma(summary.TotalOps))
+	fmt.Printf("%-22s %s hash/s\n", "Average hash rate", humanize.Comma(summary.HashRate))
+	fmt.Printf("%-22s %s\n", "Shares found", humanize.Comma(summary.Found))
+	fmt.Printf("%-22s %s\n", "Shares sent", humanize.Comma(summary.Sent))
+	fmt.Printf("%-22s %s\n", "Send failures", humanize.Comma(summary.Failures))
+	fmt.Printf("%-22s %s\n", "Shares accepted", humanize.Comma(summary.Accepted))
+	fmt.Printf("%-22s %s\n", "Shares rejected", humanize.Comma(summary.Rejected))
+	fmt.Printf("%-22s %s\n\n", "Stale shares", humanize.Comma(summary.Stale))
+
+	return nil
+}
+
+// historyMinerID resolves the name of a miner of the `miners` list to its ID
+func historyMinerID() string {
+	if historyMiner == "" {
+		return ""
+	}
+	if identities, err := loadMinerIdentities(); err == nil {
+		for _, identity := range identities {
+			if identity.Name == historyMiner {
+				return identity.MinerID
+			}
+		}
+	}
+	return historyMiner
+}
+
+// parseTimeFlag parses either a date or a duration relative to now
+func parseTimeFlag(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", value, time.Local)
+}
+
+func abbreviate(hex string) string {
+	if len(hex) <= 16 {
+		return hex
+	}
+	return hex[:16] + "…"
+}
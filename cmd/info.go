@@ -11,6 +11,7 @@ import (
 	"github.com/spf13/viper"
 	"gitlab.com/oraxpool/orax-cli/api"
 	"gitlab.com/oraxpool/orax-cli/common"
+	"gitlab.com/oraxpool/orax-cli/config"
 )
 
 var infoCmd = &cobra.Command{
@@ -18,7 +19,10 @@ var infoCmd = &cobra.Command{
 	Short: "Get miner info",
 	Run: func(cmd *cobra.Command, args []string) {
 		viper.ReadInConfig()
-		err := info()
+		err := config.CheckProfile()
+		if err == nil {
+			err = info()
+		}
 		if err != nil {
 			common.PrintError("%s\n", err.Error())
 			os.Exit(1)
@@ -37,8 +41,11 @@ func init() {
 }
 
 func info() (err error) {
-	userID := viper.GetString("user_id")
-	jwt := viper.GetString("jwt")
+	userID := config.GetString("user_id")
+	jwt, err := config.GetSecret("jwt")
+	if err != nil {
+		return err
+	}
 
 	if jwt == "" || userID == "" {
 		fmt.Printf("\nLog in:\n\n")
@@ -46,8 +53,12 @@ func info() (err error) {
 		if err != nil {
 			return err
 		}
-		viper.Set("user_id", userID)
-		viper.Set("jwt", jwt)
+		if err = config.SetValue("user_id", userID); err != nil {
+			return err
+		}
+		if err = config.SetValue("jwt", jwt); err != nil {
+			return err
+		}
 
 		fmt.Printf("\n")
 	}
@@ -62,8 +73,12 @@ func info() (err error) {
 				return err
 			}
 
-			viper.Set("user_id", userID)
-			viper.Set("jwt", jwt)
+			if err = config.SetValue("user_id", userID); err != nil {
+				return err
+			}
+			if err = config.SetValue("jwt", jwt); err != nil {
+				return err
+			}
 
 			fmt.Printf("\n")
 
@@ -76,12 +91,6 @@ func info() (err error) {
 		}
 	}
 
-	// Save the fresh JWT token for next time
-	err = viper.WriteConfig()
-	if err != nil {
-		return err
-	}
-
 	fmt.Printf("==============================================================================\n")
 	fmt.Printf("%-22s %s\n", "UserID", userID)
 	fmt.Printf("%-22s %s\n", "Email", userInfo.User.Email)
@@ -6,20 +6,34 @@ import (
 	"os/signal"
 	"runtime"
 	"syscall"
+	"time"
 
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 
 	"github.com/spf13/cobra"
 	"gitlab.com/oraxpool/orax-cli/common"
+	"gitlab.com/oraxpool/orax-cli/config"
 	"gitlab.com/oraxpool/orax-cli/hash"
 	"gitlab.com/oraxpool/orax-cli/orax"
+	"gitlab.com/oraxpool/orax-cli/trace"
 )
 
-var nbMiners int
+var (
+	nbMiners       int
+	maxLoad        float64
+	restartStalled bool
+	scheduleDryRun bool
+	traceProtocol  string
+)
 
 func init() {
 	rootCmd.AddCommand(mineCmd)
 	mineCmd.Flags().IntVarP(&nbMiners, "nbminer", "n", runtime.NumCPU(), "Number of concurrent miners. Default to number of logical CPUs.")
+	mineCmd.Flags().Float64Var(&maxLoad, "max-load", 0, "Throttle miners when the system load not caused by mining exceeds this value (Linux only). 0 to disable.")
+	mineCmd.Flags().BoolVar(&restartStalled, "restart-stalled", false, "Restart sub-miners that stop making progress.")
+	mineCmd.Flags().BoolVar(&scheduleDryRun, "schedule-dry-run", false, "Print the next transitions of the mining schedule and exit.")
+	mineCmd.Flags().StringVar(&traceProtocol, "trace-protocol", "", "Record the messages exchanged with the orchestrator to this file, see `orax-cli trace show`.")
 }
 
 var mineCmd = &cobra.Command{
@@ -28,29 +42,146 @@ var mineCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		err := viper.ReadInConfig()
 
-		if err != nil {
+		// Containers can provide the settings through the environment only
+		if _, notFound := err.(viper.ConfigFileNotFoundError); err != nil && !notFound && !os.IsNotExist(err) {
 			common.PrintError("Failed to read config: %s\n", err)
-		} else if viper.GetString("miner_id") == "" {
+			return
+		}
+
+		schedule, err := loadSchedule()
+		if err == nil {
+			err = config.CheckProfile()
+		}
+		if err == nil {
+			err = config.CheckEnv()
+		}
+		if err != nil {
+			common.PrintError("%s\n", err)
+			os.Exit(1)
+		}
+		loadMinerOptions(cmd)
+
+		if scheduleDryRun {
+			printSchedule(schedule)
+		} else if config.GetString("miner_id") == "" && !config.IsSet("miners") {
 			fmt.Printf("\nTo start mining, first register your miner with the command `orax-cli register`\n\n")
 		} else {
-			os.Exit(mine())
+			os.Exit(mine(schedule))
 		}
 	},
 }
 
-func mine() int {
+func loadSchedule() (*orax.Schedule, error) {
+	var scheduleConfig orax.ScheduleConfig
+	err := config.UnmarshalKey("schedule", &scheduleConfig)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read schedule: %s", err)
+	}
+	return orax.ParseSchedule(scheduleConfig)
+}
+
+// loadMinerOptions applies the options of the active profile
+// that aren't overridden on the command line
+func loadMinerOptions(cmd *cobra.Command) {
+	if !cmd.Flags().Changed("nbminer") && config.IsSet("nbminer") {
+		nbMiners = viper.GetInt(config.Path("nbminer"))
+	}
+	if !cmd.Flags().Changed("max-load") && config.IsSet("max_load") {
+		maxLoad = viper.GetFloat64(config.Path("max_load"))
+	}
+	if !cmd.Flags().Changed("restart-stalled") && config.IsSet("restart_stalled") {
+		restartStalled = viper.GetBool(config.Path("restart_stalled"))
+	}
+}
+
+func printSchedule(schedule *orax.Schedule) {
+	if schedule == nil {
+		fmt.Printf("\nNo mining schedule configured, mining is always allowed.\n\n")
+		return
+	}
+
+	now := time.Now()
+	state := "paused"
+	if schedule.Allowed(now) {
+		state = "allowed"
+	}
+	fmt.Printf("\nMining is currently %s.\n\n", state)
+
+	transitions := schedule.NextTransitions(now, 10)
+	if len(transitions) == 0 {
+		fmt.Printf("No transition within the next week.\n\n")
+		return
+	}
+	for _, t := range transitions {
+		state = "off"
+		if t.Allowed {
+			state = "on"
+		}
+		fmt.Printf("%-30s %s\n", t.Time.Format("Mon 2006-01-02 15:04 MST"), state)
+	}
+	fmt.Printf("\n")
+}
+
+func mine(schedule *orax.Schedule) int {
+	identities, err := loadMinerIdentities()
+	if err != nil {
+		common.PrintError("%s\n", err)
+		return 1
+	}
+
+	common.GetLog().WithField("profile", config.Profile()).Info("Using profile")
+
+	var recorder *trace.Recorder
+	if traceProtocol != "" {
+		recorder, err = trace.Create(traceProtocol)
+		if err != nil {
+			common.PrintError("Failed to create protocol trace: %s\n", err)
+			return 1
+		}
+		defer recorder.Close()
+		common.GetLog().WithField("file", traceProtocol).Info("Recording protocol trace")
+	}
+
 	hash.InitLXR()
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
 
+	// All the miners share the LXR table initialized above
 	stopOraxCli := make(chan struct{})
-	oraxCli := new(orax.Client)
-	config := orax.ClientConfig{NbMiners: nbMiners}
-	oraxCliDone := oraxCli.Start(config, stopOraxCli)
+	oraxClis := make([]*orax.Client, len(identities))
+	clientConfigs := make([]orax.ClientConfig, len(identities))
+	for i, identity := range identities {
+		if len(identities) > 1 {
+			common.GetLog().WithFields(logrus.Fields{
+				"miner":       identity.Name,
+				"nbSubMiners": identity.NbMiners,
+				"weight":      identity.Weight,
+			}).Info("Starting miner")
+		}
 
-	if oraxCliDone == nil {
-		return 1
+		oraxClis[i] = new(orax.Client)
+		clientConfigs[i] = orax.ClientConfig{
+			Name:           identity.Name,
+			MinerID:        identity.MinerID,
+			MinerSecret:    identity.MinerSecret,
+			Endpoint:       identity.Endpoint,
+			NbMiners:       identity.NbMiners,
+			MaxLoad:        maxLoad,
+			RestartStalled: restartStalled,
+			Schedule:       schedule,
+			Trace:          recorder,
+		}
 	}
+	oraxClisDone := orax.StartClients(oraxClis, clientConfigs, stopOraxCli)
+
+	// Closed once all the Orax clis exited
+	oraxCliDone := make(chan struct{})
+	go func() {
+		for _, done := range oraxClisDone {
+			<-done
+		}
+		close(oraxCliDone)
+	}()
 
 	defer func() {
 		close(stopOraxCli) // Stop orax cli.
@@ -64,6 +195,14 @@ func mine() int {
 	select {
 	case <-sigs:
 	case <-oraxCliDone: // Closed if Orax cli exits by itself (kicked by server).
+		// The miners failing to connect stop alone, the others keep mining
+		for _, oraxCli := range oraxClis {
+			if oraxCli.Err() == nil {
+				return 0
+			}
+		}
+		common.PrintError("All the miners failed to connect\n")
+		return 1
 	}
 
 	return 0
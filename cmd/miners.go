@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+
+	"gitlab.com/oraxpool/orax-cli/config"
+)
+
+// minerIdentity is an entry of the `miners` list of the config file,
+// allowing to run several miners in the same process
+type minerIdentity struct {
+	Name        string `mapstructure:"name"`
+	MinerID     string `mapstructure:"miner_id"`
+	MinerSecret string `mapstructure:"miner_secret"`
+	NbMiners    int    `mapstructure:"nbminer"`
+	Endpoint    string `mapstructure:"orchestrator_endpoint"`
+	// Share of the sub-miners given to this miner when nbminer isn't set
+	Weight float64 `mapstructure:"weight"`
+}
+
+// loadMinerIdentities returns the miners listed in the active profile
+// or the single miner registered in it
+func loadMinerIdentities() ([]minerIdentity, error) {
+	if !config.IsSet("miners") {
+		minerSecret, err := config.GetSecret("miner_secret")
+		if err != nil {
+			return nil, err
+		}
+		return []minerIdentity{{
+			MinerID:     config.GetString("miner_id"),
+			MinerSecret: minerSecret,
+			NbMiners:    nbMiners,
+		}}, nil
+	}
+
+	var identities []minerIdentity
+	err := config.UnmarshalKey("miners", &identities)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read miners: %s", err)
+	}
+	if len(identities) == 0 {
+		return nil, fmt.Errorf("No miner listed in `miners`")
+	}
+
+	names := make(map[string]bool)
+	for i := range identities {
+		identity := &identities[i]
+		if identity.MinerSecret == "" && identity.MinerID != "" {
+			if identity.MinerSecret, err = config.GetMinerSecret(identity.MinerID); err != nil {
+				return nil, err
+			}
+		}
+		if identity.MinerID == "" || identity.MinerSecret == "" {
+			return nil, fmt.Errorf("Miner %d is missing miner_id or miner_secret", i+1)
+		}
+		if identity.Name == "" {
+			identity.Name = identity.MinerID
+		}
+		if names[identity.Name] {
+			return nil, fmt.Errorf("Duplicate miner name [%s]", identity.Name)
+		}
+		names[identity.Name] = true
+		if identity.Weight < 0 {
+			return nil, fmt.Errorf("Negative weight for miner [%s]", identity.Name)
+		}
+		if identity.Weight == 0 {
+			identity.Weight = 1
+		}
+	}
+
+	err = splitSubMiners(identities, nbMiners)
+	if err != nil {
+		return nil, err
+	}
+	return identities, nil
+}
+
+// splitSubMiners divides the sub-miners left by the miners with an explicit
+// nbminer between the other ones proportionally to their weight, using the
+// largest remainder method
+func splitSubMiners(identities []minerIdentity, total int) error {
+	var weighted []int
+	var totalWeight float64
+	explicit := 0
+	for i, identity := range identities {
+		if identity.NbMiners <= 0 {
+			weighted = append(weighted, i)
+			totalWeight += identity.Weight
+		} else {
+			explicit += identity.NbMiners
+		}
+	}
+	if explicit > total {
+		return fmt.Errorf("The nbminer of the miners add up to %d sub-miners, more than the %d available, decrease them or increase --nbminer", explicit, total)
+	}
+	if len(weighted) == 0 {
+		return nil
+	}
+	total -= explicit
+
+	remainders := make([]float64, len(weighted))
+	allocated := 0
+	for j, i := range weighted {
+		share := float64(total) * identities[i].Weight / totalWeight
+		identities[i].NbMiners = int(share)
+		remainders[j] = share - float64(identities[i].NbMiners)
+		allocated += identities[i].NbMiners
+	}
+
+	order := make([]int, len(weighted))
+	for j := range order {
+		order[j] = j
+	}
+	sort.SliceStable(order, func(a, b int) bool { return remainders[order[a]] > remainders[order[b]] })
+	for j := 0; allocated < total; j++ {
+		identities[weighted[order[j]]].NbMiners++
+		allocated++
+	}
+
+	for _, i := range weighted {
+		if identities[i].NbMiners == 0 {
+			return fmt.Errorf("Not enough sub-miners (%d) to give one to miner [%s], increase --nbminer or its weight", total, identities[i].Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitSubMiners(t *testing.T) {
+	tests := []struct {
+		name     string
+		total    int
+		nbMiners []int
+		weights  []float64
+		expected []int
+		err      bool
+	}{
+		{"single miner", 8, []int{0}, []float64{1}, []int{8}, false},
+		{"equal weights", 8, []int{0, 0}, []float64{1, 1}, []int{4, 4}, false},
+		{"uneven weights", 8, []int{0, 0}, []float64{3, 1}, []int{6, 2}, false},
+		{"largest remainders", 10, []int{0, 0, 0}, []float64{1, 1, 1}, []int{4, 3, 3}, false},
+		{"remainders by weight", 7, []int{0, 0, 0}, []float64{1, 2, 4}, []int{1, 2, 4}, false},
+		{"remainder to the largest fraction", 5, []int{0, 0}, []float64{1, 2}, []int{2, 3}, false},
+		{"explicit and weighted", 8, []int{4, 0, 0}, []float64{1, 1, 1}, []int{4, 2, 2}, false},
+		{"explicit and uneven weights", 10, []int{2, 0, 0}, []float64{1, 1, 3}, []int{2, 2, 6}, false},
+		{"explicit only", 8, []int{2, 3}, []float64{1, 1}, []int{2, 3}, false},
+		{"all taken by explicit", 8, []int{8, 0}, []float64{1, 1}, nil, true},
+		{"explicit above the total", 8, []int{6, 4}, []float64{1, 1}, nil, true},
+		{"not enough sub-miners", 2, []int{0, 0, 0}, []float64{1, 1, 1}, nil, true},
+		{"weight too small", 4, []int{0, 0}, []float64{10, 1}, nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require := require.New(t)
+
+			identities := make([]minerIdentity, len(test.nbMiners))
+			for i := range identities {
+				identities[i] = minerIdentity{Name: string(rune('a' + i)), NbMiners: test.nbMiners[i], Weight: test.weights[i]}
+			}
+			err := splitSubMiners(identities, test.total)
+			if test.err {
+				require.Error(err)
+				return
+			}
+			require.NoError(err)
+			split := make([]int, len(identities))
+			for i, identity := range identities {
+				split[i] = identity.NbMiners
+			}
+			require.Equal(test.expected, split)
+		})
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/spf13/viper"
 	"gitlab.com/oraxpool/orax-cli/api"
 	"gitlab.com/oraxpool/orax-cli/common"
+	"gitlab.com/oraxpool/orax-cli/config"
 )
 
 var usernameFlag, passwordFlag, aliasFlag string
@@ -29,8 +30,11 @@ var registerCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		err := viper.ReadInConfig()
 
-		if err == nil && viper.IsSet("miner_id") {
-			common.PrintError("A miner identity is already configured in [%s]. Aborting registration.\n", configFilePath)
+		if err == nil && config.IsSet("miner_id") {
+			common.PrintError("A miner identity is already configured for profile [%s] in [%s]. Aborting registration.\n", config.Profile(), configFilePath)
+		} else if err := config.CheckProfile(); err != nil {
+			common.PrintError("%s\n", err)
+			os.Exit(1)
 		} else {
 			// Write a blank config file early to verify it's possible
 			// (permission, file extension...)
@@ -65,8 +69,13 @@ func registerNonInteractive() error {
 	}
 	common.PrintSuccess("\nSuccessfully authenticated.")
 
-	viper.Set("user_id", result.ID)
-	viper.Set("jwt", result.JWT)
+	err = config.SetValue("user_id", result.ID)
+	if err == nil {
+		err = config.SetValue("jwt", result.JWT)
+	}
+	if err != nil {
+		return err
+	}
 
 	err = registerMiner(aliasFlag)
 	if err != nil {
@@ -167,10 +176,10 @@ func getOraxUser() (err error) {
 		common.PrintSuccess("\nSuccessfully authenticated.\n\n")
 	}
 
-	viper.Set("user_id", userID)
-	viper.Set("jwt", jwt)
-
-	return nil
+	if err := config.SetValue("user_id", userID); err != nil {
+		return err
+	}
+	return config.SetValue("jwt", jwt)
 }
 
 func registerMinerPrompt() error {
@@ -190,8 +199,8 @@ func registerMiner(alias string) error {
 		return err
 	}
 
-	viper.Set("miner_id", miner.ID)
-	viper.Set("miner_secret", miner.Secret)
-
-	return nil
+	if err := config.SetValue("miner_id", miner.ID); err != nil {
+		return err
+	}
+	return config.SetValue("miner_secret", miner.Secret)
 }
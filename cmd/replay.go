@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"syscall"
+
+	humanize "github.com/dustin/go-humanize"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gitlab.com/oraxpool/orax-cli/common"
+	"gitlab.com/oraxpool/orax-cli/hash"
+	"gitlab.com/oraxpool/orax-cli/orax"
+	"gitlab.com/oraxpool/orax-cli/replay"
+	"gitlab.com/oraxpool/orax-cli/state"
+	"gitlab.com/oraxpool/orax-cli/trace"
+)
+
+var replayCmd = &cobra.Command{
+	Use:   "replay <trace>",
+	Short: "Replay a protocol trace against a fake orchestrator and compare the submitted shares",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		identical, err := replayTrace(args[0])
+		if err != nil {
+			common.PrintError("%s\n", err)
+			os.Exit(1)
+		}
+		if !identical {
+			os.Exit(2)
+		}
+	},
+}
+
+var (
+	replaySpeed     float64
+	replayMiner     string
+	replayNbMiners  int
+	replayTolerance float64
+)
+
+func init() {
+	rootCmd.AddCommand(replayCmd)
+	replayCmd.Flags().Float64Var(&replaySpeed, "speed", 1, "Speed up the messages of the orchestrator by this factor.")
+	replayCmd.Flags().StringVar(&replayMiner, "miner", "", "Miner to replay when the trace contains several.")
+	replayCmd.Flags().IntVarP(&replayNbMiners, "nbminer", "n", runtime.NumCPU(), "Number of concurrent miners, use the number of the recorded session to get the same shares.")
+	replayCmd.Flags().Float64Var(&replayTolerance, "tolerance", 0.1, "Share of the nonces of a submit window allowed to differ, as the sub-miners don't hash at the same pace in both sessions. 0 to require the same nonces.")
+}
+
+// replayTrace returns false if the shares submitted
+// during the replay differ from the recorded ones
+func replayTrace(path string) (bool, error) {
+	if replaySpeed <= 0 {
+		return false, fmt.Errorf("Invalid --speed %v, it must be positive", replaySpeed)
+	}
+	if replayTolerance < 0 || replayTolerance > 1 {
+		return false, fmt.Errorf("Invalid --tolerance %v, it must be between 0 and 1", replayTolerance)
+	}
+
+	frames, err := trace.Read(path)
+	if err != nil {
+		return false, err
+	}
+	frames, err = replay.Select(frames, replayMiner)
+	if err != nil {
+		return false, err
+	}
+	server, err := replay.NewServer(frames, replaySpeed)
+	if err != nil {
+		return false, err
+	}
+	defer server.Close()
+
+	// The session and the hash rate of the replay are recorded in a temporary
+	// directory rather than in the history and the state of the actual miner
+	dir, err := ioutil.TempDir("", "orax-replay")
+	if err != nil {
+		return false, fmt.Errorf("Failed to create the replay directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv(state.PathEnv, filepath.Join(dir, "state.json"))
+	viper.SetConfigFile(filepath.Join(dir, "config.yml"))
+
+	hash.InitLXR()
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Reset()
+
+	common.GetLog().WithField("endpoint", server.URL).Info("Replaying trace")
+	stop := make(chan struct{})
+	done := new(orax.Client).Start(orax.ClientConfig{
+		Name:        "replay",
+		MinerID:     "replay",
+		MinerSecret: "replay",
+		Endpoint:    server.URL,
+		NbMiners:    replayNbMiners,
+		SkipWarmUp:  true,
+	}, stop)
+
+	interrupted := false
+	select {
+	case <-server.Done():
+	case <-done:
+	case <-sigs:
+		interrupted = true
+	}
+	close(stop)
+	<-done
+
+	diff := replay.Compare(frames, server.Replayed())
+	printReplayDiff(diff, replayTolerance)
+	if interrupted {
+		common.PrintError("Replay interrupted\n\n")
+	}
+	return diff.Matches(replayTolerance), nil
+}
+
+func printReplayDiff(diff replay.Diff, tolerance float64) {
+	nonces := func(frames []trace.Frame) string {
+		var n int
+		for _, frame := range frames {
+			n += len(trace.Nonces(frame.Raw))
+		}
+		return humanize.Comma(int64(n))
+	}
+
+	fmt.Printf("\nSubmit windows:\n\n")
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetAlignment(tablewriter.ALIGN_RIGHT)
+	table.SetHeader([]string{"", "OPR hash", "Recorded submits", "Recorded nonces", "Replayed submits", "Replayed nonces", "Common", "Only recorded", "Only replayed", "Difference"})
+	for i, w := range diff.Windows {
+		status := "!="
+		if w.Matches(tolerance) {
+			status = "=="
+		}
+		table.Append([]string{
+			fmt.Sprintf("%s %d", status, i+1),
+			abbreviate(w.OprHash),
+			strconv.Itoa(len(w.Recorded)),
+			nonces(w.Recorded),
+			strconv.Itoa(len(w.Replayed)),
+			nonces(w.Replayed),
+			humanize.Comma(int64(w.Common)),
+			humanize.Comma(int64(w.OnlyRecorded)),
+			humanize.Comma(int64(w.OnlyReplayed)),
+			fmt.Sprintf("%.1f%%", 100*w.Difference()),
+		})
+	}
+	table.Render()
+
+	fmt.Printf("\n%d nonce(s) submitted in both sessions, %d only in the recording, %d only in the replay\n\n",
+		diff.Common, diff.OnlyRecorded, diff.OnlyReplayed)
+	if diff.Matches(tolerance) {
+		common.PrintSuccess("The replay submitted the same shares, within a tolerance of %.1f%%\n\n", 100*tolerance)
+	} else {
+		common.PrintError("The replay submitted different shares, beyond a tolerance of %.1f%%\n\n", 100*tolerance)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"gitlab.com/oraxpool/orax-cli/common"
+	"gitlab.com/oraxpool/orax-cli/config"
 )
 
 var rootCmd = &cobra.Command{
@@ -18,6 +19,7 @@ var rootCmd = &cobra.Command{
 var (
 	configFilePath string
 	logColor       string
+	profile        string
 )
 
 func init() {
@@ -25,6 +27,7 @@ func init() {
 	rootCmd.Version = common.Version
 	rootCmd.PersistentFlags().StringVarP(&configFilePath, "config", "c", "", "Config file path (default $HOME/.orax/config.yml)")
 	rootCmd.PersistentFlags().StringVar(&logColor, "color", "auto", "Log color: [auto|on|off]")
+	rootCmd.PersistentFlags().StringVar(&profile, "profile", "", "Profile of the config file to use (default $ORAX_PROFILE, then the `profile` setting)")
 }
 
 func Execute() {
@@ -57,5 +60,11 @@ func initConfig() {
 		viper.AddConfigPath(configFolderPath)
 	}
 
+	if profile == "" {
+		profile = os.Getenv("ORAX_PROFILE")
+	}
+	config.SelectProfile(profile)
+	config.PassphraseFunc = promptPassphrase
+
 	common.SetLogConfig(logColor)
 }
@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gitlab.com/oraxpool/orax-cli/common"
+	"gitlab.com/oraxpool/orax-cli/config"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+var secretsCmd = &cobra.Command{
+	Use:   "secrets",
+	Short: "Manage the storage of the miner secret and the API token",
+}
+
+var secretsMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Move the plaintext secrets of the config file to an encrypted store",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		readConfigOrExit()
+		exitOnError(migrateSecrets())
+	},
+}
+
+var secretsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the secrets kept in the store",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		readConfigOrExit()
+		store, err := config.SecretsStore()
+		exitOnError(err)
+		if store == nil {
+			fmt.Printf("\nSecrets are kept in the config file, see `orax-cli secrets migrate`\n\n")
+			return
+		}
+		keys, err := store.Keys()
+		exitOnError(err)
+		fmt.Printf("\nStore: %s\n\n", viper.GetString("secrets_store"))
+		for _, key := range keys {
+			fmt.Println(key)
+		}
+		fmt.Printf("\n")
+	},
+}
+
+var secretsStore string
+
+func init() {
+	rootCmd.AddCommand(secretsCmd)
+	secretsCmd.AddCommand(secretsMigrateCmd, secretsListCmd)
+	secretsMigrateCmd.Flags().StringVar(&secretsStore, "store", config.SecretsStoreFile, "Secrets store: [file|keyring]. The file is encrypted with a passphrase.")
+}
+
+// promptPassphrase unlocks the secrets file with $ORAX_SECRETS_PASSPHRASE,
+// or asks for the passphrase in a terminal
+func promptPassphrase() (string, error) {
+	if passphrase := os.Getenv(config.PassphraseEnv); passphrase != "" {
+		return passphrase, nil
+	}
+	if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		return "", fmt.Errorf("Set %s to unlock the secrets file when running unattended", config.PassphraseEnv)
+	}
+	return askPassphrase()
+}
+
+func migrateSecrets() error {
+	if current := viper.GetString("secrets_store"); current != "" && current != secretsStore {
+		return fmt.Errorf("Secrets are already kept in the %s store", current)
+	}
+
+	// A new secrets file is encrypted with a confirmed passphrase
+	if _, err := os.Stat(config.SecretsFilePath()); secretsStore == config.SecretsStoreFile && os.IsNotExist(err) {
+		passphrase, err := promptPassphrase()
+		if err != nil {
+			return err
+		}
+		if os.Getenv(config.PassphraseEnv) == "" {
+			if err := askPassphraseConfirmation(passphrase); err != nil {
+				return err
+			}
+		}
+		config.PassphraseFunc = func() (string, error) { return passphrase, nil }
+	}
+
+	store, err := config.OpenSecretsStore(secretsStore)
+	if err != nil {
+		return err
+	}
+	moved, err := config.MigrateSecrets(store, secretsStore)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range moved {
+		fmt.Printf("Moved %s\n", path)
+	}
+	common.PrintSuccess("\nSecrets are now kept in the %s store.", secretsStore)
+	if secretsStore == config.SecretsStoreFile {
+		fmt.Printf(" Set %s to mine unattended.", config.PassphraseEnv)
+	}
+	fmt.Printf("\n\n")
+	return nil
+}
@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gitlab.com/oraxpool/orax-cli/common"
+	"gitlab.com/oraxpool/orax-cli/trace"
+)
+
+var traceCmd = &cobra.Command{
+	Use:   "trace",
+	Short: "Inspect protocol traces recorded with `mine --trace-protocol`",
+}
+
+var traceShowCmd = &cobra.Command{
+	Use:   "show <file>",
+	Short: "Print the messages of a protocol trace",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := showTrace(args[0]); err != nil {
+			common.PrintError("%s\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+var (
+	traceMiner  string
+	traceNonces bool
+)
+
+func init() {
+	rootCmd.AddCommand(traceCmd)
+	traceCmd.AddCommand(traceShowCmd)
+	traceShowCmd.Flags().StringVar(&traceMiner, "miner", "", "Only show the messages of this miner.")
+	traceShowCmd.Flags().BoolVar(&traceNonces, "nonces", false, "Print the nonces of the submit messages.")
+}
+
+var directionArrows = map[trace.Direction]string{
+	trace.Inbound:    "<-",
+	trace.Outbound:   "->",
+	trace.Connect:    "==",
+	trace.Disconnect: "xx",
+}
+
+func showTrace(path string) error {
+	frames, err := trace.Read(path)
+	if err != nil {
+		return err
+	}
+	if len(frames) == 0 {
+		fmt.Printf("\nNo message recorded in [%s]\n\n", path)
+		return nil
+	}
+
+	fmt.Printf("\nTrace started at %s\n\n", frames[0].Time.Local().Format("2006-01-02 15:04:05.000 MST"))
+	for _, frame := range frames {
+		if traceMiner != "" && frame.Miner != traceMiner {
+			continue
+		}
+
+		name := frame.Type
+		if name == "" {
+			name = strings.Title(string(frame.Direction))
+		}
+		miner := ""
+		if frame.Miner != "" {
+			miner = "[" + frame.Miner + "] "
+		}
+		line := fmt.Sprintf("%12s  %s%s  %-24s %s", fmt.Sprintf("+%.3fs", frame.Time.Sub(frames[0].Time).Seconds()),
+			miner, directionArrows[frame.Direction], name, formatTraceFields(frame.Fields))
+		fmt.Println(strings.TrimRight(line, " "))
+
+		if traceNonces {
+			for _, nonce := range trace.Nonces(frame.Raw) {
+				fmt.Printf("%16s %x\n", "", nonce)
+			}
+		}
+	}
+	fmt.Printf("\n")
+	return nil
+}
+
+func formatTraceFields(fields map[string]interface{}) string {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	formatted := make([]string, len(keys))
+	for i, key := range keys {
+		if nested, ok := fields[key].(map[string]interface{}); ok {
+			formatted[i] = key + "={" + formatTraceFields(nested) + "}"
+		} else {
+			formatted[i] = fmt.Sprintf("%s=%v", key, fields[key])
+		}
+	}
+	return strings.Join(formatted, " ")
+}
@@ -0,0 +1,85 @@
+package common
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Fingerprint identifies the hardware the hash rates were measured on
+type Fingerprint struct {
+	CPUModel string
+	Cores    int
+	// Total memory in GiB
+	Memory uint64
+	Arch   string
+}
+
+var (
+	fingerprint     Fingerprint
+	fingerprintOnce sync.Once
+)
+
+// GetFingerprint returns the fingerprint of the machine
+func GetFingerprint() Fingerprint {
+	fingerprintOnce.Do(func() {
+		fingerprint = Fingerprint{
+			CPUModel: readProcField("/proc/cpuinfo", "model name"),
+			Cores:    runtime.NumCPU(),
+			Arch:     runtime.GOOS + "/" + runtime.GOARCH,
+		}
+		// MemTotal: 16314304 kB
+		if kb, err := strconv.ParseUint(strings.TrimSuffix(readProcField("/proc/meminfo", "MemTotal"), " kB"), 10, 64); err == nil {
+			fingerprint.Memory = (kb + 1<<19) >> 20
+		}
+	})
+	return fingerprint
+}
+
+// ID is a short hash of the fingerprint
+func (f Fingerprint) ID() string {
+	sum := sha256.Sum256([]byte(f.String()))
+	return fmt.Sprintf("%x", sum[:6])
+}
+
+func (f Fingerprint) String() string {
+	cpuModel := f.CPUModel
+	if cpuModel == "" {
+		cpuModel = "unknown CPU"
+	}
+	return fmt.Sprintf("%s, %d cores, %d GiB, %s", cpuModel, f.Cores, f.Memory, f.Arch)
+}
+
+// AvailableMemory returns the memory in bytes available for new
+// allocations, false if it cannot be determined on this system
+func AvailableMemory() (uint64, bool) {
+	kb, err := strconv.ParseUint(strings.TrimSuffix(readProcField("/proc/meminfo", "MemAvailable"), " kB"), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return kb << 10, true
+}
+
+// readProcField returns the value of the first "key: value" line
+// of a /proc file, empty if unavailable
+func readProcField(path string, key string) string {
+	file, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 2)
+		if len(parts) == 2 && strings.TrimSpace(parts[0]) == key {
+			return strings.TrimSpace(parts[1])
+		}
+	}
+	return ""
+}
@@ -1,23 +1,177 @@
 package common
 
 import (
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/spf13/viper"
+	"gitlab.com/oraxpool/orax-cli/state"
 )
 
+const (
+	// Number of sessions kept per miner count
+	HashRateHistorySize = 20
+	// Sessions shorter than this are too noisy to be recorded
+	MinHashRateSampleDuration = 30 * time.Second
+
+	hashRatesKey = "hash_rates"
+	// Keys of the hash rates stored by the versions predating the fingerprint
+	legacyHashRatePrefix        = "hash_rate_"
+	legacyHashRateHistoryPrefix = "hash_rate_history_"
+)
+
+// HashRateSample is the hash rate measured during a mining session
+type HashRateSample = state.HashRateSample
+
+// legacyHashRates is the history of hash rates as
+// previously stored in the config file
+type legacyHashRates struct {
+	Fingerprint string                            `mapstructure:"fingerprint"`
+	History     map[string][]legacyHashRateSample `mapstructure:"history"`
+}
+
+type legacyHashRateSample struct {
+	Time     int64   `mapstructure:"time"`
+	HashRate int64   `mapstructure:"hash_rate"`
+	Duration float64 `mapstructure:"duration"`
+}
+
+func init() {
+	state.RegisterMigration(migrateHashRates)
+}
+
+// GetIndicativeHashRate returns the median hash rate of the latest sessions
+// mined with nbMiners sub-miners on this machine, 0 if none was recorded
 func GetIndicativeHashRate(nbMiners int) int64 {
-	return viper.GetInt64(buildKey(nbMiners))
+	samples := getHashRates().History[strconv.Itoa(nbMiners)]
+	if len(samples) == 0 {
+		return 0
+	}
+	return medianHashRate(samples)
 }
 
+// SaveIndicativeHashRate records the hash rate of a session in the history
+// of nbMiners. Sessions shorter than MinHashRateSampleDuration are discarded.
+// The history is kept in the state file, or only in memory without one.
 func SaveIndicativeHashRate(nbMiners int, totalOps int64, duration time.Duration) error {
-	hashRate := int64(float64(totalOps) / duration.Seconds())
-	key := buildKey(nbMiners)
-	viper.Set(key, hashRate)
-	return viper.WriteConfig()
+	if duration < MinHashRateSampleDuration {
+		return nil
+	}
+
+	fingerprint := GetFingerprint().ID()
+	return state.Update(func(s *state.State) {
+		if s.HashRates.Fingerprint != fingerprint {
+			s.HashRates = state.HashRates{Fingerprint: fingerprint, History: make(map[string][]HashRateSample)}
+		}
+
+		key := strconv.Itoa(nbMiners)
+		samples := append(s.HashRates.History[key], HashRateSample{
+			Time:     time.Now().Unix(),
+			HashRate: int64(float64(totalOps) / duration.Seconds()),
+			Duration: duration.Seconds(),
+		})
+		if len(samples) > HashRateHistorySize {
+			samples = samples[len(samples)-HashRateHistorySize:]
+		}
+		s.HashRates.History[key] = samples
+	})
 }
 
-func buildKey(nbMiners int) string {
-	return "hash_rate_" + strconv.Itoa(nbMiners)
+// GetHashRateHistory returns the recorded sessions of nbMiners, oldest first
+func GetHashRateHistory(nbMiners int) []HashRateSample {
+	return getHashRates().History[strconv.Itoa(nbMiners)]
+}
+
+// HashRateHistoryMinerCounts returns the miner counts having a recorded history
+func HashRateHistoryMinerCounts() []int {
+	var counts []int
+	for key := range getHashRates().History {
+		if n, err := strconv.Atoi(key); err == nil {
+			counts = append(counts, n)
+		}
+	}
+	sort.Ints(counts)
+	return counts
+}
+
+// getHashRates returns the stored hash rates, emptied
+// if they were measured on a different hardware
+func getHashRates() state.HashRates {
+	rates := state.Get().HashRates
+	if rates.Fingerprint != GetFingerprint().ID() {
+		return state.HashRates{History: make(map[string][]HashRateSample)}
+	}
+	return rates
+}
+
+// migrateHashRates copies the hash rates of the config file to the state
+func migrateHashRates(s *state.State) {
+	var legacy legacyHashRates
+	if err := viper.UnmarshalKey(hashRatesKey, &legacy); err != nil || legacy.Fingerprint == "" {
+		migrateUnfingerprintedHashRates(s)
+		return
+	}
+
+	s.HashRates.Fingerprint = legacy.Fingerprint
+	for n, samples := range legacy.History {
+		for _, sample := range samples {
+			s.HashRates.History[n] = append(s.HashRates.History[n], HashRateSample(sample))
+		}
+	}
+}
+
+// migrateUnfingerprintedHashRates copies the hash_rate_history_<n> and
+// hash_rate_<n> keys of the config file, assumed to be measured on this
+// machine. A single hash rate is only kept without a history.
+func migrateUnfingerprintedHashRates(s *state.State) {
+	history := make(map[string][]HashRateSample)
+	for _, key := range viper.AllKeys() {
+		if !strings.HasPrefix(key, legacyHashRateHistoryPrefix) {
+			continue
+		}
+		n := strings.TrimPrefix(key, legacyHashRateHistoryPrefix)
+		var samples []legacyHashRateSample
+		if _, err := strconv.Atoi(n); err != nil || viper.UnmarshalKey(key, &samples) != nil {
+			continue
+		}
+		for _, sample := range samples {
+			history[n] = append(history[n], HashRateSample(sample))
+		}
+	}
+	for _, key := range viper.AllKeys() {
+		if !strings.HasPrefix(key, legacyHashRatePrefix) {
+			continue
+		}
+		n := strings.TrimPrefix(key, legacyHashRatePrefix)
+		if _, err := strconv.Atoi(n); err != nil || len(history[n]) > 0 {
+			continue
+		}
+		if hashRate := viper.GetInt64(key); hashRate > 0 {
+			history[n] = []HashRateSample{{HashRate: hashRate}}
+		}
+	}
+	if len(history) == 0 {
+		return
+	}
+
+	s.HashRates.Fingerprint = GetFingerprint().ID()
+	for n, samples := range history {
+		s.HashRates.History[n] = samples
+	}
+}
+
+func medianHashRate(samples []HashRateSample) int64 {
+	rates := make([]int64, len(samples))
+	for i, s := range samples {
+		rates[i] = s.HashRate
+	}
+	sort.Slice(rates, func(i, j int) bool { return rates[i] < rates[j] })
+
+	middle := len(rates) / 2
+	if len(rates)%2 == 0 {
+		return (rates[middle-1] + rates[middle]) / 2
+	}
+	return rates[middle]
 }
@@ -4,14 +4,16 @@ import (
 	"testing"
 	"time"
 
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/require"
+	"gitlab.com/oraxpool/orax-cli/state"
 )
 
 func TestIndicativeHashRate(t *testing.T) {
 	require := require.New(t)
 
-	SaveIndicativeHashRate(1, 10000, time.Duration(1)*time.Second)
-	SaveIndicativeHashRate(2, 22000, time.Duration(1)*time.Second)
+	SaveIndicativeHashRate(1, 600000, time.Duration(60)*time.Second)
+	SaveIndicativeHashRate(2, 1320000, time.Duration(60)*time.Second)
 	SaveIndicativeHashRate(3, 2100000, time.Duration(60)*time.Second)
 
 	require.Equal(GetIndicativeHashRate(1), int64(10000))
@@ -19,4 +21,55 @@ func TestIndicativeHashRate(t *testing.T) {
 	require.Equal(GetIndicativeHashRate(3), int64(35000))
 	require.Equal(GetIndicativeHashRate(4), int64(0))
 
+	// Short sessions are discarded
+	SaveIndicativeHashRate(1, 1000, time.Duration(1)*time.Second)
+	require.Len(GetHashRateHistory(1), 1)
+
+	// A single outlier doesn't move the median
+	SaveIndicativeHashRate(1, 660000, time.Duration(60)*time.Second)
+	SaveIndicativeHashRate(1, 60000, time.Duration(60)*time.Second)
+	require.Equal(GetIndicativeHashRate(1), int64(10000))
+
+	for i := 0; i < 2*HashRateHistorySize; i++ {
+		SaveIndicativeHashRate(5, 600000, time.Duration(60)*time.Second)
+	}
+	require.Len(GetHashRateHistory(5), HashRateHistorySize)
+	require.Equal([]int{1, 2, 3, 5}, HashRateHistoryMinerCounts())
+}
+
+func TestIndicativeHashRateFingerprint(t *testing.T) {
+	require := require.New(t)
+
+	SaveIndicativeHashRate(6, 600000, time.Duration(60)*time.Second)
+	require.Equal(GetIndicativeHashRate(6), int64(10000))
+
+	// Rates measured on another machine are ignored
+	state.Update(func(s *state.State) { s.HashRates.Fingerprint = "000000000000" })
+	require.Equal(GetIndicativeHashRate(6), int64(0))
+	require.Empty(HashRateHistoryMinerCounts())
+
+	// and replaced by the first session mined on this one
+	SaveIndicativeHashRate(2, 1320000, time.Duration(60)*time.Second)
+	require.Equal([]int{2}, HashRateHistoryMinerCounts())
+}
+
+func TestMigrateUnfingerprintedHashRates(t *testing.T) {
+	require := require.New(t)
+
+	viper.Set("hash_rate_history_2", []map[string]interface{}{
+		{"time": 1, "hash_rate": 21000, "duration": 60},
+		{"time": 2, "hash_rate": 23000, "duration": 60},
+	})
+	viper.Set("hash_rate_2", 20000)
+	viper.Set("hash_rate_4", 40000)
+	defer viper.Reset()
+
+	s := &state.State{HashRates: state.HashRates{History: make(map[string][]HashRateSample)}}
+	migrateHashRates(s)
+
+	require.Equal(GetFingerprint().ID(), s.HashRates.Fingerprint)
+	require.Equal([]HashRateSample{{Time: 1, HashRate: 21000, Duration: 60}, {Time: 2, HashRate: 23000, Duration: 60}}, s.HashRates.History["2"])
+	// The single hash rate is only kept without a history
+	require.Equal([]HashRateSample{{HashRate: 40000}}, s.HashRates.History["4"])
+	require.Len(s.HashRates.History, 2)
 }
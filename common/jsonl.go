@@ -0,0 +1,25 @@
+package common
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+)
+
+// ReadJSONLines decodes each line of r into a value of newValue and passes
+// it to add. Lines longer than maxLineSize fail the read, 0 for the default.
+func ReadJSONLines(r io.Reader, maxLineSize int, newValue func() interface{}, add func(interface{})) error {
+	scanner := bufio.NewScanner(r)
+	if maxLineSize > 0 {
+		scanner.Buffer(nil, maxLineSize)
+	}
+	for scanner.Scan() {
+		value := newValue()
+		if err := json.Unmarshal(scanner.Bytes(), value); err != nil {
+			// Skip lines corrupted by an interrupted write
+			continue
+		}
+		add(value)
+	}
+	return scanner.Err()
+}
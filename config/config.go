@@ -0,0 +1,156 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Get returns the value of the key in the environment, the state
+// file or the config file, or its default
+func Get(k Key) (value interface{}, set bool) {
+	if value, ok, _ := lookupEnv(k.Name); ok {
+		return value, true
+	}
+	if value, ok := getState(k.Name); ok {
+		return value, true
+	}
+	if !viper.IsSet(Path(k.Name)) {
+		return k.Default, false
+	}
+	return viper.Get(Path(k.Name)), true
+}
+
+// Set validates and writes the value of the key in the config file
+func Set(k Key, value string) error {
+	parsed, err := k.Parse(value)
+	if err != nil && k.Type == Structured {
+		return err
+	} else if err != nil {
+		return fmt.Errorf("Invalid %s value for [%s]: %s", k.Type, k.Name, err)
+	}
+	saved, err := setValue(k.Name, parsed)
+	if err != nil || saved {
+		return err
+	}
+	return viper.WriteConfig()
+}
+
+// Unset removes the key of the active profile from the config file,
+// the state file, and from the secrets store for secrets
+func Unset(name string) error {
+	if _, ok := getState(name); ok {
+		if err := setState(Profile(), name, ""); err != nil {
+			return err
+		}
+	}
+	if k, err := Lookup(name); err == nil && k.Secret {
+		store, err := SecretsStore()
+		if err != nil {
+			return err
+		}
+		if store != nil {
+			if err := store.Delete(Path(name)); err != nil {
+				return err
+			}
+		}
+	}
+	return removePaths(Path(name))
+}
+
+// removePaths rewrites the config file without the given keys
+func removePaths(paths ...string) error {
+	settings := viper.AllSettings()
+
+	removed := false
+	for _, p := range paths {
+		// Walk down to the map holding the key
+		path := strings.Split(p, ".")
+		parent := settings
+		for _, field := range path[:len(path)-1] {
+			child, ok := parent[field].(map[string]interface{})
+			if !ok {
+				parent = nil
+				break
+			}
+			parent = child
+		}
+		if _, ok := parent[path[len(path)-1]]; ok {
+			delete(parent, path[len(path)-1])
+			removed = true
+		}
+	}
+	if !removed {
+		return nil
+	}
+
+	// viper cannot remove a key, rewrite the file from the remaining settings
+	v := viper.New()
+	for key, value := range settings {
+		v.Set(key, value)
+	}
+	if err := v.WriteConfigAs(viper.ConfigFileUsed()); err != nil {
+		return err
+	}
+	return viper.ReadInConfig()
+}
+
+// UnknownKeys returns the keys of the config file missing from the schema
+func UnknownKeys() []string {
+	var unknown []string
+	for key := range viper.AllSettings() {
+		if _, err := Lookup(key); err != nil {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+// formatStructured prints nested lists and maps as indented lines,
+// masking the secret fields
+func formatStructured(value interface{}, showSecrets bool, indent string) string {
+	var b strings.Builder
+	switch v := value.(type) {
+	case []interface{}:
+		for _, item := range v {
+			b.WriteString("\n" + indent + "-" + strings.Replace(formatStructured(item, showSecrets, indent+"  "), "\n"+indent+"  ", " ", 1))
+		}
+	case []map[string]interface{}:
+		for _, item := range v {
+			b.WriteString("\n" + indent + "-" + strings.Replace(formatStructured(item, showSecrets, indent+"  "), "\n"+indent+"  ", " ", 1))
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			b.WriteString(formatField(key, v[key], showSecrets, indent))
+		}
+	case map[interface{}]interface{}:
+		keys := make([]string, 0, len(v))
+		values := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			keys = append(keys, fmt.Sprint(key))
+			values[fmt.Sprint(key)] = value
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			b.WriteString(formatField(key, values[key], showSecrets, indent))
+		}
+	default:
+		return " " + fmt.Sprint(v)
+	}
+	return b.String()
+}
+
+func formatField(key string, value interface{}, showSecrets bool, indent string) string {
+	if secretFields[key] && !showSecrets {
+		return "\n" + indent + key + ": " + mask(fmt.Sprint(value))
+	}
+	return "\n" + indent + key + ":" + formatStructured(value, showSecrets, indent+"  ")
+}
@@ -0,0 +1,43 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/oraxpool/orax-cli/state"
+)
+
+func TestSetWritesConfigFile(t *testing.T) {
+	require := require.New(t)
+	defer viper.Reset()
+
+	dir, err := ioutil.TempDir("", "config")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+	os.Setenv(state.PathEnv, filepath.Join(dir, "state.json"))
+	defer os.Unsetenv(state.PathEnv)
+	path := filepath.Join(dir, "config.yml")
+	require.NoError(ioutil.WriteFile(path, []byte("miner_id: m1\n"), 0600))
+	viper.SetConfigFile(path)
+	require.NoError(viper.ReadInConfig())
+
+	// Without secrets store, secrets are written to the config file like the other keys
+	for name, value := range map[string]string{"miner_secret": "s3cr3t", "nbminer": "4"} {
+		k, err := Lookup(name)
+		require.NoError(err)
+		require.NoError(Set(k, value))
+	}
+
+	viper.Reset()
+	viper.SetConfigFile(path)
+	require.NoError(viper.ReadInConfig())
+	require.Equal("m1", GetString("miner_id"))
+	require.Equal(4, viper.GetInt("nbminer"))
+	secret, err := GetSecret("miner_secret")
+	require.NoError(err)
+	require.Equal("s3cr3t", secret)
+}
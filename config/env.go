@@ -0,0 +1,52 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// Keys with FromEnv set are read, by order of precedence, from:
+//   1. the ORAX_<KEY> environment variable (ORAX_MINER_SECRET)
+//   2. the file at ORAX_<KEY>_FILE (ORAX_MINER_SECRET_FILE), as mounted
+//      for Docker and Kubernetes secrets
+//   3. the state file, for the runtime state such as user_id and jwt
+//   4. the secrets store, for secrets
+//   5. the active profile of the config file
+
+// EnvName returns the environment variable of the key
+func EnvName(name string) string {
+	return "ORAX_" + strings.ToUpper(name)
+}
+
+// lookupEnv returns the value of the key set in the environment
+func lookupEnv(name string) (string, bool, error) {
+	if k, err := Lookup(name); err != nil || !k.FromEnv {
+		return "", false, nil
+	}
+
+	env := EnvName(name)
+	if value := os.Getenv(env); value != "" {
+		return value, true, nil
+	}
+	if path := os.Getenv(env + "_FILE"); path != "" {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", false, fmt.Errorf("Failed to read %s_FILE: %s", env, err)
+		}
+		// Secret files usually end with a newline
+		return strings.TrimRight(string(content), "\r\n"), true, nil
+	}
+	return "", false, nil
+}
+
+// CheckEnv verifies the files referenced by the environment are readable
+func CheckEnv() error {
+	for _, k := range keys {
+		if _, _, err := lookupEnv(k.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
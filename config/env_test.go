@@ -0,0 +1,43 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvPrecedence(t *testing.T) {
+	require := require.New(t)
+	defer viper.Reset()
+
+	viper.Set("miner_id", "from-config")
+	viper.Set("miner_secret", "from-config")
+	require.Equal("from-config", GetString("miner_id"))
+
+	f, err := ioutil.TempFile("", "miner_secret")
+	require.NoError(err)
+	defer os.Remove(f.Name())
+	f.WriteString("from-file\n")
+	f.Close()
+
+	os.Setenv("ORAX_MINER_SECRET_FILE", f.Name())
+	defer os.Unsetenv("ORAX_MINER_SECRET_FILE")
+	secret, err := GetSecret("miner_secret")
+	require.NoError(err)
+	require.Equal("from-file", secret)
+
+	os.Setenv("ORAX_MINER_SECRET", "from-env")
+	defer os.Unsetenv("ORAX_MINER_SECRET")
+	secret, err = GetSecret("miner_secret")
+	require.NoError(err)
+	require.Equal("from-env", secret)
+
+	os.Setenv("ORAX_JWT_FILE", "/nonexistent")
+	defer os.Unsetenv("ORAX_JWT_FILE")
+	_, err = GetSecret("jwt")
+	require.Error(err)
+	require.Error(CheckEnv())
+}
@@ -0,0 +1,191 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// DefaultProfile is used when no profile is selected,
+// set at build time for the distributed binaries
+var DefaultProfile = "local"
+
+type endpoints struct {
+	api          string
+	orchestrator string
+}
+
+var builtinProfiles = map[string]endpoints{
+	"production": {"https://api.oraxpool.com", "wss://orchestrator.oraxpool.com/miner"},
+	"staging":    {"https://api.staging.oraxpool.com", "wss://orchestrator.staging.oraxpool.com/miner"},
+	"local":      {"http://localhost:2666", "ws://localhost:8077/miner"},
+}
+
+// Profile selected by --profile or ORAX_PROFILE
+var selectedProfile string
+
+// SelectProfile overrides the profile of the config file
+func SelectProfile(name string) {
+	selectedProfile = strings.ToLower(name)
+}
+
+// Profile returns the active profile: the selected one,
+// the one set in the config file or the default one
+func Profile() string {
+	if selectedProfile != "" {
+		return selectedProfile
+	}
+	if profile := viper.GetString("profile"); profile != "" {
+		return strings.ToLower(profile)
+	}
+	return DefaultProfile
+}
+
+// usesProfileSection tells if the settings of the profile are stored in
+// its `profiles` section. The default profile may use the top level of
+// the config file, as before profiles existed.
+func usesProfileSection(profile string) bool {
+	return profile != DefaultProfile || viper.IsSet("profiles."+profile)
+}
+
+// Path returns where the key is stored for the active profile. Profiled keys
+// belong to the profile, the others are shared but can be overridden by it.
+func Path(name string) string {
+	return profilePath(Profile(), name)
+}
+
+func profilePath(profile string, name string) string {
+	path := "profiles." + profile + "." + name
+	if k, err := Lookup(name); err == nil && !k.Profiled {
+		if viper.IsSet(path) {
+			return path
+		}
+		return name
+	}
+	if usesProfileSection(profile) {
+		return path
+	}
+	return name
+}
+
+// GetString returns the value of the key for the active profile, the
+// environment first. Unreadable files are reported by CheckEnv.
+func GetString(name string) string {
+	if value, ok, _ := lookupEnv(name); ok {
+		return value
+	}
+	if value, ok := getState(name); ok {
+		return value
+	}
+	return viper.GetString(Path(name))
+}
+
+func IsSet(name string) bool {
+	if _, ok, _ := lookupEnv(name); ok {
+		return true
+	}
+	if _, ok := getState(name); ok {
+		return true
+	}
+	return viper.IsSet(Path(name))
+}
+
+// SetValue sets the key for the active profile. Secrets are saved right
+// away when a secrets store is configured, runtime state in the state
+// file, otherwise the config file still has to be written.
+func SetValue(name string, value interface{}) error {
+	_, err := setValue(name, value)
+	return err
+}
+
+// setValue returns whether the value was saved, or only set
+// in memory until the config file is written
+func setValue(name string, value interface{}) (saved bool, err error) {
+	if k, err := Lookup(name); err == nil && k.Secret {
+		store, err := SecretsStore()
+		if err != nil {
+			return false, err
+		}
+		if store != nil {
+			if err := store.Set(Path(name), fmt.Sprint(value)); err != nil {
+				return false, err
+			}
+			// Don't leave the previous secret in plaintext
+			if viper.GetString(Path(name)) != "" {
+				if err := removePaths(Path(name)); err != nil {
+					return false, err
+				}
+			}
+			if _, ok := getState(name); ok {
+				return true, setState(Profile(), name, "")
+			}
+			return true, nil
+		}
+	}
+	if _, ok := stateFields[name]; ok {
+		return true, setState(Profile(), name, fmt.Sprint(value))
+	}
+	viper.Set(Path(name), value)
+	return false, nil
+}
+
+func UnmarshalKey(name string, rawVal interface{}) error {
+	return viper.UnmarshalKey(Path(name), rawVal)
+}
+
+// APIEndpoint returns the Orax API endpoint of the active profile
+func APIEndpoint() string {
+	if endpoint := GetString("api_endpoint"); endpoint != "" {
+		return endpoint
+	}
+	return builtinProfiles[Profile()].api
+}
+
+// OrchestratorEndpoint returns the orchestrator endpoint of the active profile
+func OrchestratorEndpoint() string {
+	if endpoint := GetString("orchestrator_endpoint"); endpoint != "" {
+		return endpoint
+	}
+	return builtinProfiles[Profile()].orchestrator
+}
+
+// CheckProfile verifies the active profile defines valid endpoints
+func CheckProfile() error {
+	profile := Profile()
+	_, builtin := builtinProfiles[profile]
+	if !builtin && !viper.IsSet("profiles."+profile) {
+		return fmt.Errorf("Unknown profile [%s], define it in the `profiles` section of the config file", profile)
+	}
+
+	for name, endpoint := range map[string]string{"api_endpoint": APIEndpoint(), "orchestrator_endpoint": OrchestratorEndpoint()} {
+		if endpoint == "" {
+			return fmt.Errorf("Profile [%s] is missing %s", profile, name)
+		}
+		if _, err := url.ParseRequestURI(endpoint); err != nil {
+			return fmt.Errorf("Invalid %s of profile [%s]: %s", name, profile, err)
+		}
+	}
+	return nil
+}
+
+// Profiles returns the names of the built-in profiles
+// and of the profiles defined in the config file
+func Profiles() []string {
+	names := make(map[string]bool)
+	for name := range builtinProfiles {
+		names[name] = true
+	}
+	for name := range viper.GetStringMap("profiles") {
+		names[name] = true
+	}
+
+	var sorted []string
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
@@ -0,0 +1,148 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+type Type int
+
+const (
+	String Type = iota
+	Int
+	Float
+	Bool
+	Duration
+	URL
+	// Lists and maps, edited in the config file
+	Structured
+)
+
+var ErrUnknownKey = errors.New("Unknown config key")
+
+func (t Type) String() string {
+	switch t {
+	case Int:
+		return "int"
+	case Float:
+		return "float"
+	case Bool:
+		return "bool"
+	case Duration:
+		return "duration"
+	case URL:
+		return "url"
+	case Structured:
+		return "structured"
+	default:
+		return "string"
+	}
+}
+
+// Key is a setting of the config file
+type Key struct {
+	Name        string
+	Type        Type
+	Default     interface{}
+	Description string
+	// Masked on display
+	Secret bool
+	// Set by orax-cli itself, not meant to be edited
+	Managed bool
+	// Specific to each profile, see Path
+	Profiled bool
+	// Can be set by the environment, see EnvName
+	FromEnv bool
+}
+
+var keys = []Key{
+	{Name: "profile", Type: String, Description: "Profile used when --profile and ORAX_PROFILE aren't set"},
+	{Name: "profiles", Type: Structured, Description: "Settings specific to each profile"},
+	{Name: "api_endpoint", Type: URL, Description: "Orax API endpoint", Profiled: true},
+	{Name: "orchestrator_endpoint", Type: URL, Description: "Orax orchestrator endpoint", Profiled: true},
+	{Name: "user_id", Type: String, Description: "ID of the Orax user, set when logging in", Managed: true, Profiled: true, FromEnv: true},
+	{Name: "jwt", Type: String, Description: "Authentication token of the Orax API, set when logging in", Secret: true, Managed: true, Profiled: true, FromEnv: true},
+	{Name: "miner_id", Type: String, Description: "ID of the miner, set by `orax-cli register`", Profiled: true, FromEnv: true},
+	{Name: "miner_secret", Type: String, Description: "Secret of the miner, set by `orax-cli register`", Secret: true, Profiled: true, FromEnv: true},
+	{Name: "miners", Type: Structured, Description: "Miners run in the same process instead of miner_id", Profiled: true},
+	{Name: "nbminer", Type: Int, Description: "Number of concurrent miners when --nbminer isn't set"},
+	{Name: "max_load", Type: Float, Description: "Default of --max-load"},
+	{Name: "restart_stalled", Type: Bool, Default: false, Description: "Default of --restart-stalled"},
+	{Name: "compression", Type: Bool, Default: true, Description: "Compress the messages exchanged with the orchestrator if it supports it"},
+	{Name: "compression_threshold", Type: Int, Default: 256, Description: "Size in bytes from which messages are compressed"},
+	{Name: "schedule", Type: Structured, Description: "Time windows during which mining is allowed"},
+	{Name: "secrets_store", Type: String, Description: "Where secrets are kept instead of the config file: file or keyring, set by `orax-cli secrets migrate`", Managed: true},
+}
+
+// secretFields are masked inside structured values
+var secretFields = map[string]bool{
+	"miner_secret": true,
+	"jwt":          true,
+}
+
+// Keys returns the known keys sorted by name
+func Keys() []Key {
+	sorted := make([]Key, len(keys))
+	copy(sorted, keys)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	return sorted
+}
+
+// Lookup returns the known key with the given name
+func Lookup(name string) (Key, error) {
+	for _, k := range keys {
+		if k.Name == name {
+			return k, nil
+		}
+	}
+	return Key{}, fmt.Errorf("%s [%s], see `orax-cli config list --all`", ErrUnknownKey, name)
+}
+
+// Parse validates a value given on the command line and
+// converts it to the type of the key
+func (k Key) Parse(value string) (interface{}, error) {
+	switch k.Type {
+	case Int:
+		return strconv.Atoi(value)
+	case Float:
+		return strconv.ParseFloat(value, 64)
+	case Bool:
+		return strconv.ParseBool(value)
+	case Duration:
+		if _, err := time.ParseDuration(value); err != nil {
+			return nil, err
+		}
+		return value, nil
+	case URL:
+		if _, err := url.ParseRequestURI(value); err != nil {
+			return nil, err
+		}
+		return value, nil
+	case Structured:
+		return nil, fmt.Errorf("[%s] must be edited in the config file", k.Name)
+	default:
+		return value, nil
+	}
+}
+
+// Format returns the value for display, secrets masked unless showSecrets
+func (k Key) Format(value interface{}, showSecrets bool) string {
+	if k.Secret && !showSecrets {
+		return mask(fmt.Sprint(value))
+	}
+	if k.Type == Structured {
+		return formatStructured(value, showSecrets, "")
+	}
+	return fmt.Sprint(value)
+}
+
+func mask(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "********"
+}
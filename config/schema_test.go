@@ -0,0 +1,40 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeys(t *testing.T) {
+	require := require.New(t)
+
+	_, err := Lookup("nope")
+	require.Error(err)
+
+	k, err := Lookup("miner_secret")
+	require.NoError(err)
+	require.Equal("********", k.Format("abc", false))
+	require.Equal("abc", k.Format("abc", true))
+
+	k = Key{Name: "n", Type: Int}
+	v, err := k.Parse("12")
+	require.NoError(err)
+	require.Equal(12, v)
+	_, err = k.Parse("twelve")
+	require.Error(err)
+
+	k = Key{Name: "u", Type: URL}
+	_, err = k.Parse("not a url")
+	require.Error(err)
+
+	miners, err := Lookup("miners")
+	require.NoError(err)
+	_, err = miners.Parse("x")
+	require.Error(err)
+	formatted := miners.Format([]interface{}{
+		map[interface{}]interface{}{"name": "a", "miner_secret": "s3cr3t"},
+	}, false)
+	require.Contains(formatted, "name: a")
+	require.NotContains(formatted, "s3cr3t")
+}
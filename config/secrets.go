@@ -0,0 +1,206 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/spf13/viper"
+	"gitlab.com/oraxpool/orax-cli/secrets"
+	"gitlab.com/oraxpool/orax-cli/state"
+)
+
+const (
+	SecretsStoreFile    = "file"
+	SecretsStoreKeyring = "keyring"
+
+	// Passphrase of the secrets file for unattended mining
+	PassphraseEnv = "ORAX_SECRETS_PASSPHRASE"
+)
+
+// PassphraseFunc returns the passphrase of the secrets file,
+// replaced by the cli to prompt for it
+var PassphraseFunc = func() (string, error) {
+	if passphrase := os.Getenv(PassphraseEnv); passphrase != "" {
+		return passphrase, nil
+	}
+	return "", errors.New("Set " + PassphraseEnv + " to unlock the secrets file")
+}
+
+var (
+	storeMux sync.Mutex
+	stores   = make(map[string]secrets.Store)
+)
+
+// SecretsFilePath returns the path of the encrypted secrets file
+func SecretsFilePath() string {
+	return filepath.Join(filepath.Dir(viper.ConfigFileUsed()), "secrets.enc")
+}
+
+// SecretsStore returns the store set by `secrets_store`,
+// nil if the secrets are kept in the config file
+func SecretsStore() (secrets.Store, error) {
+	return OpenSecretsStore(viper.GetString("secrets_store"))
+}
+
+// OpenSecretsStore returns the store of the given kind, nil for none
+func OpenSecretsStore(kind string) (secrets.Store, error) {
+	storeMux.Lock()
+	defer storeMux.Unlock()
+
+	if kind == "" {
+		return nil, nil
+	}
+	if store, ok := stores[kind]; ok {
+		return store, nil
+	}
+
+	var store secrets.Store
+	switch kind {
+	case SecretsStoreFile:
+		store = secrets.NewFileStore(SecretsFilePath(), func() (string, error) { return PassphraseFunc() })
+	case SecretsStoreKeyring:
+		keyring, err := secrets.NewKeyringStore("orax-cli")
+		if err != nil {
+			return nil, err
+		}
+		store = keyring
+	default:
+		return nil, fmt.Errorf("Unknown secrets_store [%s], use %s or %s", kind, SecretsStoreFile, SecretsStoreKeyring)
+	}
+	stores[kind] = store
+	return store, nil
+}
+
+// GetSecret returns the secret of the active profile from the
+// environment, the state file, the secrets store or the config file
+func GetSecret(name string) (string, error) {
+	if value, ok, err := lookupEnv(name); ok || err != nil {
+		return value, err
+	}
+	if value, ok := getState(name); ok {
+		return value, nil
+	}
+	value, err := getStoredSecret(Path(name))
+	if err != nil || value != "" {
+		return value, err
+	}
+	return viper.GetString(Path(name)), nil
+}
+
+// GetMinerSecret returns the secret of a miner of the `miners` list
+// of the active profile kept in the secrets store, empty if not found
+func GetMinerSecret(minerID string) (string, error) {
+	return getStoredSecret(minerSecretPath(Path("miners"), minerID))
+}
+
+// minerSecretPath is the path in the store of the secret of a miner
+// of a `miners` list, by miner id as the list may be reordered
+func minerSecretPath(miners string, minerID string) string {
+	return miners + "." + minerID + ".miner_secret"
+}
+
+func getStoredSecret(path string) (string, error) {
+	store, err := SecretsStore()
+	if err != nil || store == nil {
+		return "", err
+	}
+	value, err := store.Get(path)
+	if err != nil {
+		return "", fmt.Errorf("Failed to read %s from the secrets store: %s", path, err)
+	}
+	return value, nil
+}
+
+// MigrateSecrets moves the plaintext secrets of all the profiles from the
+// config and state files to the store, including the ones of the `miners` lists
+func MigrateSecrets(store secrets.Store, kind string) (moved []string, err error) {
+	prefixes := []string{""}
+	for profile := range viper.GetStringMap("profiles") {
+		prefixes = append(prefixes, "profiles."+profile+".")
+	}
+
+	for _, prefix := range prefixes {
+		for _, k := range keys {
+			path := prefix + k.Name
+			if k.Secret {
+				if value := viper.GetString(path); value != "" {
+					if err := store.Set(path, value); err != nil {
+						return nil, err
+					}
+					moved = append(moved, path)
+				}
+			}
+		}
+
+		var identities []map[string]interface{}
+		viper.UnmarshalKey(prefix+"miners", &identities)
+		migrated := false
+		for _, identity := range identities {
+			minerID, _ := identity["miner_id"].(string)
+			secret, _ := identity["miner_secret"].(string)
+			if minerID == "" || secret == "" {
+				continue
+			}
+			path := minerSecretPath(prefix+"miners", minerID)
+			if err := store.Set(path, secret); err != nil {
+				return nil, err
+			}
+			delete(identity, "miner_secret")
+			moved = append(moved, path)
+			migrated = true
+		}
+		if migrated {
+			viper.Set(prefix+"miners", identities)
+		}
+	}
+
+	// The state is more recent than the config file
+	inState := make(map[string]bool)
+	for profile, p := range state.Get().Profiles {
+		for name, field := range stateFields {
+			if k, _ := Lookup(name); k.Secret && *field(p) != "" {
+				if err := store.Set(profilePath(profile, name), *field(p)); err != nil {
+					return nil, err
+				}
+				inState[profilePath(profile, name)] = true
+			}
+		}
+	}
+	err = state.Update(func(s *state.State) {
+		for _, p := range s.Profiles {
+			for name, field := range stateFields {
+				if k, _ := Lookup(name); k.Secret {
+					*field(p) = ""
+				}
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The secrets are safe in the store, remove them from the config file
+	viper.Set("secrets_store", kind)
+	if err := viper.WriteConfig(); err != nil {
+		return nil, err
+	}
+	removed := moved
+	for path := range inState {
+		if !contains(moved, path) {
+			moved = append(moved, path)
+		}
+	}
+	return moved, removePaths(removed...)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/oraxpool/orax-cli/secrets"
+	"gitlab.com/oraxpool/orax-cli/state"
+)
+
+// withSecretsFile reads the config in a temporary directory
+// next to a secrets file and returns the store
+func withSecretsFile(t *testing.T, content string) (secrets.Store, func()) {
+	dir, err := ioutil.TempDir("", "config")
+	require.NoError(t, err)
+	os.Setenv(state.PathEnv, filepath.Join(dir, "state.json"))
+	os.Setenv(PassphraseEnv, "passphrase")
+	path := filepath.Join(dir, "config.yml")
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+	viper.SetConfigFile(path)
+	require.NoError(t, viper.ReadInConfig())
+
+	store, err := OpenSecretsStore(SecretsStoreFile)
+	require.NoError(t, err)
+	return store, func() {
+		storeMux.Lock()
+		stores = make(map[string]secrets.Store)
+		storeMux.Unlock()
+		viper.Reset()
+		os.Unsetenv(PassphraseEnv)
+		os.Unsetenv(state.PathEnv)
+		os.RemoveAll(dir)
+	}
+}
+
+func TestSetSecretWithStore(t *testing.T) {
+	require := require.New(t)
+	store, cleanup := withSecretsFile(t, "secrets_store: file\nminer_secret: plaintext\n")
+	defer cleanup()
+
+	// The store takes precedence over a plaintext secret left in the config
+	require.NoError(store.Set("miner_secret", "stored"))
+	secret, err := GetSecret("miner_secret")
+	require.NoError(err)
+	require.Equal("stored", secret)
+
+	k, err := Lookup("miner_secret")
+	require.NoError(err)
+	require.NoError(Set(k, "s3cr3t"))
+	secret, err = GetSecret("miner_secret")
+	require.NoError(err)
+	require.Equal("s3cr3t", secret)
+	content, err := ioutil.ReadFile(viper.ConfigFileUsed())
+	require.NoError(err)
+	require.NotContains(string(content), "miner_secret")
+}
+
+func TestMigrateMinersSecrets(t *testing.T) {
+	require := require.New(t)
+	store, cleanup := withSecretsFile(t, `miner_secret: s0
+miners:
+- miner_id: m1
+  miner_secret: s1
+- miner_id: m2
+  miner_secret: s2
+  nbminer: 2
+`)
+	defer cleanup()
+
+	moved, err := MigrateSecrets(store, SecretsStoreFile)
+	require.NoError(err)
+	require.Equal([]string{"miner_secret", "miners.m1.miner_secret", "miners.m2.miner_secret"}, moved)
+
+	content, err := ioutil.ReadFile(viper.ConfigFileUsed())
+	require.NoError(err)
+	require.NotContains(string(content), "miner_secret")
+	secret, err := GetMinerSecret("m2")
+	require.NoError(err)
+	require.Equal("s2", secret)
+	var identities []map[string]interface{}
+	require.NoError(UnmarshalKey("miners", &identities))
+	require.Len(identities, 2)
+	require.Equal(2, identities[1]["nbminer"])
+}
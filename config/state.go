@@ -0,0 +1,108 @@
+package config
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+	"gitlab.com/oraxpool/orax-cli/state"
+)
+
+// stateFields are the keys of the profiles kept in the state file,
+// orax-cli never writes them to the config file
+var stateFields = map[string]func(*state.ProfileState) *string{
+	"user_id": func(p *state.ProfileState) *string { return &p.UserID },
+	"jwt":     func(p *state.ProfileState) *string { return &p.JWT },
+}
+
+func init() {
+	state.RegisterMigration(migrateState)
+}
+
+// getState returns the value of the key for the active profile
+// from the state file
+func getState(name string) (string, bool) {
+	field, ok := stateFields[name]
+	if !ok {
+		return "", false
+	}
+	profile := state.Get().Profiles[Profile()]
+	if profile == nil || *field(profile) == "" {
+		return "", false
+	}
+	return *field(profile), true
+}
+
+func setState(profile string, name string, value string) error {
+	return state.Update(func(s *state.State) {
+		*stateFields[name](s.Profile(profile)) = value
+	})
+}
+
+// migrateState copies the keys previously saved in the
+// config file to the state of each profile
+func migrateState(s *state.State) {
+	for _, profile := range Profiles() {
+		for name, field := range stateFields {
+			if value := viper.GetString(profilePath(profile, name)); value != "" {
+				*field(s.Profile(profile)) = value
+			}
+		}
+	}
+}
+
+// LegacyStateKeys returns the paths of the config file holding
+// runtime state, now kept in the state file
+func LegacyStateKeys() []string {
+	var paths []string
+	for _, profile := range Profiles() {
+		for _, k := range keys {
+			if _, ok := stateFields[k.Name]; ok && viper.IsSet(profilePath(profile, k.Name)) {
+				paths = append(paths, profilePath(profile, k.Name))
+			}
+		}
+	}
+	if viper.IsSet("hash_rates") {
+		paths = append(paths, "hash_rates")
+	}
+	// hash_rate_<n> and hash_rate_history_<n> of the versions predating hash_rates
+	var hashRateKeys []string
+	for _, key := range viper.AllKeys() {
+		n := strings.TrimPrefix(strings.TrimPrefix(key, "hash_rate_history_"), "hash_rate_")
+		if _, err := strconv.Atoi(n); err == nil && n != key {
+			hashRateKeys = append(hashRateKeys, key)
+		}
+	}
+	sort.Strings(hashRateKeys)
+	return append(paths, hashRateKeys...)
+}
+
+// LastEndpoint returns the orchestrator endpoint the miner was
+// redirected to during its previous connection, if any
+func LastEndpoint(minerID string) string {
+	profile := state.Get().Profiles[Profile()]
+	if profile == nil {
+		return ""
+	}
+	return profile.LastEndpoints[minerID]
+}
+
+// SaveLastEndpoint remembers the endpoint the miner is connected
+// to, an empty endpoint forgets it
+func SaveLastEndpoint(minerID string, endpoint string) error {
+	if LastEndpoint(minerID) == endpoint {
+		return nil
+	}
+	return state.Update(func(s *state.State) {
+		profile := s.Profile(Profile())
+		if endpoint == "" {
+			delete(profile.LastEndpoints, minerID)
+			return
+		}
+		if profile.LastEndpoints == nil {
+			profile.LastEndpoints = make(map[string]string)
+		}
+		profile.LastEndpoints[minerID] = endpoint
+	})
+}
@@ -27,6 +27,7 @@ require (
 	github.com/spf13/viper v1.5.0
 	github.com/stretchr/testify v1.4.0
 	gitlab.com/oraxpool/orax-message v0.0.0-20190921191632-bfac1083c89e
+	golang.org/x/crypto v0.0.0-20190308221718-c2843e01d9a2
 	gopkg.in/resty.v1 v1.12.0
 )
 
@@ -1,12 +1,16 @@
 package hash
 
 import (
+	"math/rand"
 	"sync"
 
 	lxr "github.com/pegnet/LXRHash"
 	"gitlab.com/oraxpool/orax-cli/common"
 )
 
+// Size in bits of the LXR lookup table, held in memory while mining
+const MapSizeBits = 30
+
 var LX lxr.LXRHash
 var once sync.Once
 
@@ -18,10 +22,22 @@ func InitLXR() {
 	once.Do(func() {
 		log.Info("Initializing LXR hash...")
 		LX.Verbose(true)
-		LX.Init(0xfafaececfafaecec, 30, 256, 5)
+		LX.Init(0xfafaececfafaecec, MapSizeBits, 256, 5)
 	})
 }
 
+// InitTestLXR sets up a small in memory table instead of
+// the one generated by InitLXR, for the tests mining
+func InitTestLXR() {
+	LX.Seed = 0xfafaececfafaecec
+	LX.MapSizeBits = 10
+	LX.MapSize = 1 << 10
+	LX.HashSize = 32
+	LX.Passes = 5
+	LX.ByteMap = make([]byte, LX.MapSize)
+	rand.New(rand.NewSource(1)).Read(LX.ByteMap)
+}
+
 func Hash(data []byte) []byte {
 	return LX.Hash(data)
 }
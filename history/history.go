@@ -0,0 +1,173 @@
+package history
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/viper"
+	"gitlab.com/oraxpool/orax-cli/common"
+)
+
+const fileName = "history.jsonl"
+
+// Session is an entry of the mining session journal
+type Session struct {
+	MinerID        string        `json:"minerId"`
+	StartTime      time.Time     `json:"startTime"`
+	EndTime        time.Time     `json:"endTime"`
+	PausedDuration time.Duration `json:"pausedDuration"`
+	OprHash        string        `json:"oprHash"`
+	Target         uint64        `json:"target"`
+	TotalOps       int64         `json:"totalOps"`
+	BestDifficulty uint64        `json:"bestDifficulty"`
+	SharesFound    int64         `json:"sharesFound"`
+	SharesSent     int64         `json:"sharesSent"`
+	SendFailures   int64         `json:"sendFailures"`
+	// Shares acknowledged by the orchestrator
+	SharesAccepted int64 `json:"sharesAccepted"`
+	SharesRejected int64 `json:"sharesRejected"`
+	SharesStale    int64 `json:"sharesStale"`
+	// Time the sub-miners idled by load-aware throttling
+	// would have taken all together
+	ThrottledIdleDuration time.Duration `json:"throttledIdleDuration,omitempty"`
+}
+
+// Duration of the session from start to end
+func (s Session) Duration() time.Duration {
+	return s.EndTime.Sub(s.StartTime)
+}
+
+// ActiveDuration of actual mining, excluding the paused and throttled time
+func (s Session) ActiveDuration() time.Duration {
+	return s.Duration() - s.PausedDuration - s.ThrottledIdleDuration
+}
+
+func (s Session) HashRate() int64 {
+	if s.ActiveDuration() <= 0 {
+		return 0
+	}
+	return int64(float64(s.TotalOps) / s.ActiveDuration().Seconds())
+}
+
+// Path of the journal, stored next to the config file.
+// Empty when running without a config file.
+func Path() string {
+	if viper.ConfigFileUsed() == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(viper.ConfigFileUsed()), fileName)
+}
+
+// Append a session at the end of the journal
+func Append(session Session) error {
+	if Path() == "" {
+		return nil
+	}
+	f, err := os.OpenFile(Path(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	line, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// Filter selects sessions of the journal, zero values disable the criteria
+type Filter struct {
+	// Sessions started within [Since, Until)
+	Since time.Time
+	Until time.Time
+	// Sessions mined as this miner
+	MinerID string
+}
+
+func (f Filter) match(session Session) bool {
+	if !f.Since.IsZero() && session.StartTime.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !session.StartTime.Before(f.Until) {
+		return false
+	}
+	return f.MinerID == "" || session.MinerID == f.MinerID
+}
+
+// Read the sessions of the journal matching the filter
+func Read(filter Filter) ([]Session, error) {
+	if Path() == "" {
+		return nil, nil
+	}
+	f, err := os.Open(Path())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var sessions []Session
+	err = common.ReadJSONLines(f, 0, func() interface{} { return new(Session) }, func(v interface{}) {
+		if session := *v.(*Session); filter.match(session) {
+			sessions = append(sessions, session)
+		}
+	})
+	return sessions, err
+}
+
+// Latest returns the n most recent sessions, all of them if n is 0
+func Latest(sessions []Session, n int) []Session {
+	if n > 0 && len(sessions) > n {
+		return sessions[len(sessions)-n:]
+	}
+	return sessions
+}
+
+// Summary sums up the sessions of the journal
+type Summary struct {
+	Sessions       int
+	First          time.Time
+	Last           time.Time
+	Duration       time.Duration
+	ActiveDuration time.Duration
+	TotalOps       int64
+	HashRate       int64
+	Found          int64
+	Sent           int64
+	Failures       int64
+	Accepted       int64
+	Rejected       int64
+	Stale          int64
+}
+
+// Summarize the sessions, sorted by start time
+func Summarize(sessions []Session) Summary {
+	var summary Summary
+	if len(sessions) == 0 {
+		return summary
+	}
+	summary.Sessions = len(sessions)
+	summary.First = sessions[0].StartTime
+	summary.Last = sessions[len(sessions)-1].StartTime
+	for _, s := range sessions {
+		summary.Duration += s.Duration()
+		summary.ActiveDuration += s.ActiveDuration()
+		summary.TotalOps += s.TotalOps
+		summary.Found += s.SharesFound
+		summary.Sent += s.SharesSent
+		summary.Failures += s.SendFailures
+		summary.Accepted += s.SharesAccepted
+		summary.Rejected += s.SharesRejected
+		summary.Stale += s.SharesStale
+	}
+	if summary.ActiveDuration > 0 {
+		summary.HashRate = int64(float64(summary.TotalOps) / summary.ActiveDuration.Seconds())
+	}
+	return summary
+}
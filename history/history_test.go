@@ -0,0 +1,101 @@
+package history
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistory(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "history")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+	viper.SetConfigFile(filepath.Join(dir, "config.yml"))
+	defer viper.Reset()
+
+	// Nothing recorded yet
+	sessions, err := Read(Filter{})
+	require.NoError(err)
+	require.Empty(sessions)
+
+	start := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		minerID := "m1"
+		if i%2 == 1 {
+			minerID = "m2"
+		}
+		require.NoError(Append(Session{
+			MinerID:        minerID,
+			StartTime:      start.Add(time.Duration(i) * time.Hour),
+			EndTime:        start.Add(time.Duration(i)*time.Hour + 10*time.Minute),
+			PausedDuration: 4 * time.Minute,
+			TotalOps:       60000,
+			SharesFound:    10,
+			SharesSent:     9,
+			SharesAccepted: 8,
+			SharesRejected: 1,
+		}))
+	}
+	// Lines corrupted by an interrupted write are skipped
+	f, err := os.OpenFile(Path(), os.O_APPEND|os.O_WRONLY, 0600)
+	require.NoError(err)
+	f.WriteString(`{"minerId":"m1","start`)
+	f.Close()
+
+	sessions, err = Read(Filter{})
+	require.NoError(err)
+	require.Len(sessions, 4)
+	require.Equal("m2", sessions[1].MinerID)
+	require.True(start.Equal(sessions[0].StartTime))
+	require.Equal(10*time.Minute, sessions[0].Duration())
+	require.Equal(6*time.Minute, sessions[0].ActiveDuration())
+	require.Equal(int64(166), sessions[0].HashRate())
+
+	sessions, err = Read(Filter{Since: start.Add(time.Hour), Until: start.Add(3 * time.Hour)})
+	require.NoError(err)
+	require.Len(sessions, 2)
+	require.True(start.Add(time.Hour).Equal(sessions[0].StartTime))
+
+	sessions, err = Read(Filter{MinerID: "m1"})
+	require.NoError(err)
+	require.Len(sessions, 2)
+	require.True(start.Add(2 * time.Hour).Equal(sessions[1].StartTime))
+
+	sessions, err = Read(Filter{})
+	require.NoError(err)
+	require.Len(Latest(sessions, 0), 4)
+	require.Len(Latest(sessions, 10), 4)
+	require.Equal(sessions[2:], Latest(sessions, 2))
+}
+
+func TestSummarize(t *testing.T) {
+	require := require.New(t)
+
+	require.Equal(Summary{}, Summarize(nil))
+
+	start := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+	summary := Summarize([]Session{
+		{StartTime: start, EndTime: start.Add(2 * time.Minute), TotalOps: 60000, SharesFound: 3, SharesAccepted: 2, SharesStale: 1},
+		// Throttled and paused time don't count in the hash rate
+		{StartTime: start.Add(time.Hour), EndTime: start.Add(time.Hour + 4*time.Minute), PausedDuration: time.Minute, ThrottledIdleDuration: time.Minute, TotalOps: 60000, SharesFound: 2, SendFailures: 1, SharesRejected: 1},
+	})
+	require.Equal(2, summary.Sessions)
+	require.Equal(start, summary.First)
+	require.Equal(start.Add(time.Hour), summary.Last)
+	require.Equal(6*time.Minute, summary.Duration)
+	require.Equal(4*time.Minute, summary.ActiveDuration)
+	require.Equal(int64(120000), summary.TotalOps)
+	require.Equal(int64(500), summary.HashRate)
+	require.Equal(int64(5), summary.Found)
+	require.Equal(int64(1), summary.Failures)
+	require.Equal(int64(2), summary.Accepted)
+	require.Equal(int64(1), summary.Rejected)
+	require.Equal(int64(1), summary.Stale)
+}
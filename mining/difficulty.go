@@ -0,0 +1,59 @@
+package mining
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// HistogramBuckets is the number of buckets of the share difficulty histogram.
+// Bucket i counts the shares with a DifficultyRatio in [2^i, 2^(i+1)),
+// the last bucket counts all the shares above.
+const HistogramBuckets = 16
+
+// DifficultyRatio returns how many times less likely it is to find
+// a hash of the given difficulty than a hash meeting the target.
+func DifficultyRatio(target uint64, difficulty uint64) float64 {
+	return (float64(^target) + 1) / (float64(^difficulty) + 1)
+}
+
+func histogramBucket(target uint64, difficulty uint64) int {
+	ratio := DifficultyRatio(target, difficulty)
+	if ratio < 1 {
+		return 0
+	}
+	bucket := int(math.Log2(ratio))
+	if bucket >= HistogramBuckets {
+		return HistogramBuckets - 1
+	}
+	return bucket
+}
+
+// ExpectedShares returns the number of shares statistically expected
+// for the number of hashes computed during the session
+func (ms *MiningSession) ExpectedShares() float64 {
+	return float64(ms.TotalOps) * (float64(^ms.Target) + 1) / math.Pow(2, 64)
+}
+
+// UnderFinding returns true if the session found significantly fewer shares
+// than expected, which is a sign of a corrupted hash table
+func (ms *MiningSession) UnderFinding() bool {
+	expected := ms.ExpectedShares()
+	return expected >= 20 && float64(ms.TotalShares) < expected/2
+}
+
+// DifficultyDistribution formats the non empty buckets of the difficulty histogram
+func (ms *MiningSession) DifficultyDistribution() string {
+	var buckets []string
+	for i, count := range ms.DifficultyHistogram {
+		if count == 0 {
+			continue
+		}
+		label := fmt.Sprintf("%dx", 1<<uint(i))
+		if i == HistogramBuckets-1 {
+			label = ">=" + label
+		}
+		buckets = append(buckets, fmt.Sprintf("%s:%d", label, count))
+	}
+	return strings.Join(buckets, " ")
+}
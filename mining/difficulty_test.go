@@ -0,0 +1,98 @@
+package mining
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Target met by one hash in 1024
+const target1024 = ^uint64(1<<54 - 1)
+
+func TestDifficultyRatio(t *testing.T) {
+	require := require.New(t)
+
+	// ^target+1 and ^difficulty+1 are the number of hashes at least as difficult
+	target := ^uint64(1023)
+	require.Equal(1.0, DifficultyRatio(target, target))
+	require.Equal(2.0, DifficultyRatio(target, ^uint64(511)))
+	require.Equal(1024.0, DifficultyRatio(target, math.MaxUint64))
+	require.Equal(0.5, DifficultyRatio(target, ^uint64(2047)))
+
+	// Every hash meets a zero target, none is harder than the maximum
+	require.Equal(math.Pow(2, 64), DifficultyRatio(0, math.MaxUint64))
+	require.Equal(1.0, DifficultyRatio(0, 0))
+	require.Equal(1.0, DifficultyRatio(math.MaxUint64, math.MaxUint64))
+}
+
+func TestHistogramBucket(t *testing.T) {
+	target := ^uint64(1023)
+	tests := []struct {
+		name       string
+		difficulty uint64
+		bucket     int
+	}{
+		{"below the target", ^uint64(2047), 0},
+		{"at the target", target, 0},
+		{"just below twice the target", ^uint64(512), 0},
+		{"twice the target", ^uint64(511), 1},
+		{"just below 4 times the target", ^uint64(256), 1},
+		{"4 times the target", ^uint64(255), 2},
+		{"highest bucket", ^uint64(0), 10},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.bucket, histogramBucket(target, test.difficulty))
+		})
+	}
+
+	// The last bucket counts all the difficulties above
+	require.Equal(t, 1, histogramBucket(0, 1<<63))
+	require.Equal(t, HistogramBuckets-1, histogramBucket(0, ^uint64(1<<40)))
+	require.Equal(t, HistogramBuckets-1, histogramBucket(0, math.MaxUint64))
+	require.Equal(t, 0, histogramBucket(math.MaxUint64, 0))
+}
+
+func TestExpectedShares(t *testing.T) {
+	require := require.New(t)
+
+	ms := &MiningSession{TotalOps: 1 << 20, Target: 0}
+	require.Equal(float64(1<<20), ms.ExpectedShares())
+	ms.Target = math.MaxUint64
+	require.Equal(math.Pow(2, -44), ms.ExpectedShares())
+	ms.Target = target1024
+	require.Equal(1024.0, ms.ExpectedShares())
+}
+
+func TestUnderFinding(t *testing.T) {
+	tests := []struct {
+		name         string
+		totalOps     int64
+		totalShares  int64
+		underFinding bool
+	}{
+		{"too few hashes to tell", 20479, 0, false},
+		{"half the expected shares", 20480, 10, false},
+		{"less than half", 20480, 9, true},
+		{"none", 20480, 0, true},
+		{"as expected", 20480, 20, false},
+		{"lucky", 20480, 40, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// One share per 1024 hashes
+			ms := &MiningSession{TotalOps: test.totalOps, TotalShares: test.totalShares, Target: target1024}
+			require.Equal(t, test.underFinding, ms.UnderFinding())
+		})
+	}
+}
+
+func TestDifficultyDistribution(t *testing.T) {
+	ms := new(MiningSession)
+	require.Equal(t, "", ms.DifficultyDistribution())
+	ms.DifficultyHistogram[0] = 12
+	ms.DifficultyHistogram[3] = 2
+	ms.DifficultyHistogram[HistogramBuckets-1] = 1
+	require.Equal(t, "1x:12 8x:2 >=32768x:1", ms.DifficultyDistribution())
+}
@@ -0,0 +1,99 @@
+package mining
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	hashRateWindow         = time.Minute
+	hashRateSampleInterval = time.Second
+)
+
+type hashRateSample struct {
+	ops      int64
+	duration time.Duration
+}
+
+// hashRateEstimator computes the hash rate over the last hashRateWindow
+// of mining time, the time between sessions and the paused time excluded
+type hashRateEstimator struct {
+	mux      sync.Mutex
+	samples  []hashRateSample
+	ops      int64
+	duration time.Duration
+}
+
+func (e *hashRateEstimator) add(ops int64, duration time.Duration) {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+
+	e.samples = append(e.samples, hashRateSample{ops: ops, duration: duration})
+	e.ops += ops
+	e.duration += duration
+
+	for len(e.samples) > 1 && e.duration-e.samples[0].duration >= hashRateWindow {
+		e.ops -= e.samples[0].ops
+		e.duration -= e.samples[0].duration
+		e.samples = e.samples[1:]
+	}
+}
+
+func (e *hashRateEstimator) rate() int64 {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+
+	if e.duration <= 0 {
+		return 0
+	}
+	return int64(float64(e.ops) / e.duration.Seconds())
+}
+
+// HashRate returns the hash rate measured over the latest minute of mining,
+// 0 if the miner hasn't mined yet
+func (sm *SuperMiner) HashRate() int64 {
+	return sm.hashRate.rate()
+}
+
+func (sm *SuperMiner) totalOps() int64 {
+	sm.statsMux.Lock()
+	defer sm.statsMux.Unlock()
+
+	var ops int64
+	for _, miner := range sm.miners {
+		ops += miner.totalOps()
+	}
+	return ops
+}
+
+// sampleHashRate feeds the hash rate estimator with the progress of the
+// sub-miners until stop is closed, once the workers of the session are done
+func (sm *SuperMiner) sampleHashRate(s *session, stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(hashRateSampleInterval)
+	defer ticker.Stop()
+
+	last := s.ms.StartTime
+	var lastOps int64
+	sample := func(now time.Time) {
+		ops := sm.totalOps()
+		duration := now.Sub(last)
+		if s.isPaused() {
+			duration = 0
+		}
+		sm.hashRate.add(ops-lastOps, duration)
+		lastOps = ops
+		last = now
+	}
+
+	for {
+		select {
+		case <-stop:
+			sample(time.Now())
+			return
+		case now := <-ticker.C:
+			sample(now)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package mining
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Kernel clock ticks per second used in /proc/<pid>/stat (USER_HZ)
+	clockTicksPerSecond = 100
+	// Time constant of the 1 minute load average computed by the kernel
+	loadAvgWindow = time.Minute
+)
+
+// loadSampler estimates the system load that is not caused by this process.
+// The CPU usage of the process is smoothed with the same time constant as the
+// kernel 1 minute load average so that both values can be subtracted.
+type loadSampler struct {
+	mux         sync.Mutex
+	lastSample  time.Time
+	lastCPUTime time.Duration
+	processLoad float64
+}
+
+func (s *loadSampler) nonMiningLoad() (float64, error) {
+	load, cpuTime, err := readLoad()
+	if err != nil {
+		return 0, err
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.add(load, cpuTime, time.Now()), nil
+}
+
+// add smoothes the CPU usage of the process since the previous
+// sample and subtracts it from the load average
+func (s *loadSampler) add(load float64, cpuTime time.Duration, now time.Time) float64 {
+	if !s.lastSample.IsZero() && now.After(s.lastSample) {
+		elapsed := now.Sub(s.lastSample)
+		instant := float64(cpuTime-s.lastCPUTime) / float64(elapsed)
+		alpha := 1 - math.Exp(-elapsed.Seconds()/loadAvgWindow.Seconds())
+		s.processLoad += alpha * (instant - s.processLoad)
+	}
+	s.lastSample = now
+	s.lastCPUTime = cpuTime
+
+	return math.Max(0, load-s.processLoad)
+}
+
+// readLoad returns the 1 minute load average of the system
+// and the CPU time consumed by this process, replaced by tests
+var readLoad = func() (float64, time.Duration, error) {
+	load, err := readLoadAvg()
+	if err != nil {
+		return 0, 0, err
+	}
+	cpuTime, err := readProcessCPUTime()
+	return load, cpuTime, err
+}
+
+// readLoadAvg returns the 1 minute load average of the system
+func readLoadAvg() (float64, error) {
+	f, err := os.Open("/proc/loadavg")
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return parseLoadAvg(f)
+}
+
+func parseLoadAvg(r io.Reader) (float64, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, errors.New("Empty /proc/loadavg")
+	}
+	return strconv.ParseFloat(fields[0], 64)
+}
+
+// readProcessCPUTime returns the user and system CPU time consumed by this process
+func readProcessCPUTime() (time.Duration, error) {
+	f, err := os.Open("/proc/self/stat")
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return parseProcessCPUTime(f)
+}
+
+func parseProcessCPUTime(r io.Reader) (time.Duration, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	// The command name (2nd field) can contain spaces, skip past it
+	stat := string(data)
+	end := strings.LastIndexByte(stat, ')')
+	if end < 0 {
+		return 0, errors.New("Malformed /proc/self/stat")
+	}
+	// Fields after the command name start at the 3rd field (state)
+	fields := strings.Fields(stat[end+1:])
+	if len(fields) < 13 {
+		return 0, errors.New("Malformed /proc/self/stat")
+	}
+	utime, err := strconv.ParseInt(fields[11], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	stime, err := strconv.ParseInt(fields[12], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(utime+stime) * time.Second / clockTicksPerSecond, nil
+}
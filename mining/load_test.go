@@ -0,0 +1,68 @@
+package mining
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLoadAvg(t *testing.T) {
+	require := require.New(t)
+
+	load, err := parseLoadAvg(strings.NewReader("2.35 1.80 1.20 3/512 12345\n"))
+	require.NoError(err)
+	require.Equal(2.35, load)
+
+	_, err = parseLoadAvg(strings.NewReader(""))
+	require.Error(err)
+	_, err = parseLoadAvg(strings.NewReader("high 1.80 1.20 3/512 12345\n"))
+	require.Error(err)
+}
+
+func TestParseProcessCPUTime(t *testing.T) {
+	require := require.New(t)
+
+	// The command name contains spaces and parentheses
+	stat := "1234 (orax (cli) x) R 1 2 3 4 5 6 7 8 9 10 250 50 0 0 20 0 9 0 100 0 0\n"
+	cpuTime, err := parseProcessCPUTime(strings.NewReader(stat))
+	require.NoError(err)
+	require.Equal(3*time.Second, cpuTime)
+
+	_, err = parseProcessCPUTime(strings.NewReader("1234 orax R 1 2 3"))
+	require.Error(err)
+	_, err = parseProcessCPUTime(strings.NewReader("1234 (orax) R 1 2 3"))
+	require.Error(err)
+	_, err = parseProcessCPUTime(strings.NewReader("1234 (orax) R 1 2 3 4 5 6 7 8 9 10 x 50 0"))
+	require.Error(err)
+}
+
+func TestLoadSampler(t *testing.T) {
+	require := require.New(t)
+
+	var s loadSampler
+	now := time.Unix(1600000000, 0)
+	// Nothing to subtract before a CPU usage is measured
+	require.Equal(3.0, s.add(3, 0, now))
+
+	// The process using 2 CPUs for long, its load is entirely subtracted
+	cpuTime := time.Duration(0)
+	for i := 0; i < 120; i++ {
+		now = now.Add(5 * time.Second)
+		cpuTime += 10 * time.Second
+		s.add(3, cpuTime, now)
+	}
+	require.InDelta(1, s.add(3, cpuTime+10*time.Second, now.Add(5*time.Second)), 0.01)
+
+	// The smoothed usage follows a sudden stop of the process
+	// with the time constant of the load average
+	require.InDelta(2, s.processLoad, 0.01)
+	now = now.Add(5 * time.Second)
+	cpuTime += 10 * time.Second
+	s.add(3, cpuTime, now.Add(time.Minute))
+	require.InDelta(2/2.718, s.processLoad, 0.01)
+
+	// The non mining load is never negative
+	require.Equal(0.0, s.add(0, cpuTime, now.Add(2*time.Minute)))
+}
@@ -1,9 +1,11 @@
 package mining
 
 import (
+	"context"
 	"encoding/binary"
 	"fmt"
-	"sync"
+	"sync/atomic"
+	"time"
 
 	lxr "github.com/pegnet/LXRHash"
 	"gitlab.com/oraxpool/orax-cli/hash"
@@ -12,68 +14,152 @@ import (
 var _ = fmt.Printf
 var _ = lxr.Init
 
+const (
+	// Interval at which an idle miner checks if it should resume
+	idlePollInterval = 100 * time.Millisecond
+	// Number of nonces hashed at once by HashWork
+	hashBatchSize = 256
+)
+
 type Miner struct {
-	id         int
-	stop       chan int
-	opsCounter int64
+	id   int
+	idle int32
+
+	// Counters of the current worker, and of the workers replaced
+	// during the session. A stalled worker keeps its own counters
+	// after being replaced, they aren't accounted anymore.
+	counters *workerCounters
+	retired  workerCounters
+
+	// Current worker goroutine
+	cancel     context.CancelFunc
+	done       chan struct{}
+	generation int
+
+	// Maintained by the stall watchdog
+	lastOps      int64
+	lastProgress time.Time
+	stalled      bool
+}
+
+type workerCounters struct {
+	ops    int64
+	shares int64
+	best   uint64
+}
+
+type share struct {
+	nonce      []byte
+	difficulty uint64
+}
+
+// MinerStats is a snapshot of the activity of a sub-miner during a session
+type MinerStats struct {
+	ID           int
+	TotalOps     int64
+	TotalShares  int64
+	LastProgress time.Time
+	Idle         bool
+	Stalled      bool
+	Restarts     int
 }
 
 func NewMiner(id int) *Miner {
 	miner := new(Miner)
 	miner.id = id
-	miner.stop = make(chan int)
+	miner.counters = new(workerCounters)
 
 	return miner
 }
 
 func (miner *Miner) Reset() {
-	miner.opsCounter = 0
-}
-
-func (miner *Miner) mine(oprHash []byte, noncePrefix []byte, target uint64, wg *sync.WaitGroup, c chan<- []byte, batchSize int) {
-	// Create a slice of sufficient capacity to avoid a new underlying array to be allocated
-	// when appending nonce after the OPR
-	dataToMine := make([]byte, 32, 64)
-	copy(dataToMine, oprHash)
-
-	prefixLength := len(noncePrefix) + 1
-	// Pre allocate a large enough slice of memory
-	nonce := make([]byte, 0, 64)
-	// Append the noncePrefix of the super miner, the local prefix (miner id) and the first 0
-	nonce = append(nonce, noncePrefix...)
-	nonce = append(nonce, byte(miner.id))
-	//ni := NewNonceIncrementer(nonce)
-
-	static := append(oprHash, append(noncePrefix, byte(miner.id))...)
-
-	// sequentialMine is the regular hashing function to be performed in a
-	// loop.
-	sequentialMine := func() {
-		// Increment nonce
-		i := prefixLength
-		for {
-			nonce[i]++
-			// if it overflows
-			if nonce[i] == 0 {
-				i++
-				// If we reached the end of the slice, expand it
-				if i == len(nonce) {
-					nonce = append(nonce, 0)
-					break
-				}
-			} else {
-				break
-			}
-		}
+	miner.counters = new(workerCounters)
+	miner.retired = workerCounters{}
+	miner.setIdle(false)
+	miner.generation = 0
+	miner.lastOps = 0
+	miner.lastProgress = time.Now()
+	miner.stalled = false
+}
+
+func (miner *Miner) setIdle(idle bool) {
+	var v int32
+	if idle {
+		v = 1
+	}
+	atomic.StoreInt32(&miner.idle, v)
+}
+
+func (miner *Miner) isIdle() bool {
+	return atomic.LoadInt32(&miner.idle) == 1
+}
+
+func (miner *Miner) stats() MinerStats {
+	return MinerStats{
+		ID:           miner.id,
+		TotalOps:     miner.totalOps(),
+		TotalShares:  miner.retired.shares + atomic.LoadInt64(&miner.counters.shares),
+		LastProgress: miner.lastProgress,
+		Idle:         miner.isIdle(),
+		Stalled:      miner.stalled,
+		Restarts:     miner.generation,
+	}
+}
+
+// start launches a new worker goroutine mining for the session in a nonce
+// space specific to the miner id and generation until ctx is done
+func (miner *Miner) start(ctx context.Context, s *session) {
+	ctx, miner.cancel = context.WithCancel(ctx)
+	miner.done = make(chan struct{})
+	go miner.mine(ctx, s, miner.generation, miner.counters, miner.done, hashBatchSize)
+}
+
+// restart abandons the current worker and starts a new one
+// with fresh counters in the next nonce space
+func (miner *Miner) restart(ctx context.Context, s *session) {
+	miner.cancel()
+	miner.retired.ops += atomic.LoadInt64(&miner.counters.ops)
+	miner.retired.shares += atomic.LoadInt64(&miner.counters.shares)
+	miner.retired.best = miner.bestDifficulty()
+	miner.counters = new(workerCounters)
+	miner.generation++
+	miner.start(ctx, s)
+}
+
+func (miner *Miner) totalOps() int64 {
+	return miner.retired.ops + atomic.LoadInt64(&miner.counters.ops)
+}
+
+func (miner *Miner) bestDifficulty() uint64 {
+	if best := atomic.LoadUint64(&miner.counters.best); best > miner.retired.best {
+		return best
+	}
+	return miner.retired.best
+}
+
+func (miner *Miner) mine(ctx context.Context, s *session, generation int, counters *workerCounters, done chan<- struct{}, batchSize int) {
+	defer close(done)
 
-		// Compute hash and difficulty
-		dataToHash := append(dataToMine, nonce...)
-		h := hash.Hash(dataToHash)
-		diff := computeDifficulty(h)
-		miner.opsCounter++
+	oprHash := s.ms.OprHash
+	noncePrefix := s.ms.NoncePrefix
+	target := s.ms.Target
 
-		if diff >= target {
-			c <- copyNonce(nonce)
+	static := make([]byte, 0, len(oprHash)+len(noncePrefix)+2)
+	static = append(static, oprHash...)
+	static = append(static, noncePrefix...)
+	static = append(static, byte(miner.id))
+	// Restarted workers use a distinct nonce space
+	if generation > 0 {
+		static = append(static, byte(generation))
+	}
+	var best uint64
+
+	// The collector outlives the workers of the session, only
+	// an abandoned stalled worker can find it gone
+	sendShare := func(sh share) {
+		select {
+		case s.sharesC <- sh:
+		case <-s.collectorDone:
 		}
 	}
 
@@ -96,10 +182,15 @@ func (miner *Miner) mine(oprHash []byte, noncePrefix []byte, target uint64, wg *
 			// hash = results[i]
 			h := results[i]
 			diff := computeDifficulty(h)
-			miner.opsCounter++
+			atomic.AddInt64(&counters.ops, 1)
+			if diff > best {
+				best = diff
+				atomic.StoreUint64(&counters.best, diff)
+			}
 
 			if diff >= target {
-				c <- copyNonce(append(static[32:], batch[i]...))
+				atomic.AddInt64(&counters.shares, 1)
+				sendShare(share{nonce: copyNonce(append(static[32:], batch[i]...)), difficulty: diff})
 			}
 		}
 	}
@@ -108,19 +199,23 @@ mining:
 	for {
 		// Listen for end of mining signal
 		select {
-		case <-miner.stop:
+		case <-ctx.Done():
 			break mining
 		default:
 		}
 
-		if batchSize > 0 {
-			sequentialMine()
-		} else {
-			batchMine()
+		// Throttled or paused miner waits without hashing
+		if miner.isIdle() || s.isPaused() {
+			select {
+			case <-ctx.Done():
+				break mining
+			case <-time.After(idlePollInterval):
+			}
+			continue
 		}
-	}
 
-	wg.Done()
+		batchMine()
+	}
 }
 
 // NonceIncrementer is just simple to increment nonces
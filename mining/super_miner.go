@@ -1,9 +1,12 @@
 package mining
 
 import (
+	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"gitlab.com/oraxpool/orax-cli/common"
@@ -12,15 +15,29 @@ import (
 )
 
 var log = common.GetLog()
-var nonceBufferMux sync.Mutex
+
+var (
+	ErrAlreadyRunning = errors.New("Miner is already running")
+	ErrNotRunning     = errors.New("Miner is not running")
+)
 
 type SuperMiner struct {
 	SubMinerCount int
-	running       bool
+	// Maximum system load not caused by mining before sub-miners
+	// get throttled. 0 disables throttling.
+	MaxLoad float64
+	// Restart the worker of a sub-miner that stopped making progress
+	RestartStalled bool
+	Logger         *logrus.Entry
 
-	miners        []*Miner
-	wg            *sync.WaitGroup
-	miningSession *MiningSession
+	// Protects session
+	mux     sync.Mutex
+	session *session
+
+	miners []*Miner
+	// Protects the worker and watchdog fields of the miners
+	statsMux sync.Mutex
+	hashRate hashRateEstimator
 }
 
 type MiningSession struct {
@@ -32,13 +49,81 @@ type MiningSession struct {
 	TotalOps    int64
 	TotalShares int64
 	NonceBuffer [][]byte
-	sharesC     chan []byte
 	Target      uint64
+
+	// Highest difficulty hashed, share or not
+	BestDifficulty uint64
+	// Number of shares per difficulty bucket, see DifficultyRatio
+	DifficultyHistogram [HistogramBuckets]int64
+
+	// Time actually spent hashing, the paused and throttled time
+	// excluded from Duration, to compute the hash rate
+	ActiveDuration time.Duration
+	// Time spent paused, excluded from ActiveDuration
+	PausedDuration time.Duration
+
+	// Per sub-miner stats at the end of the session
+	MinerStats []MinerStats
+
+	// Load-aware throttling stats
+	ThrottleAdjustments int
+	MinActiveMiners     int
+	ThrottledDuration   time.Duration
+	// Time the idle sub-miners would have taken all together,
+	// excluded from ActiveDuration like the paused time
+	ThrottledIdleDuration time.Duration
+}
+
+// session is the lifecycle state of a mining session
+type session struct {
+	ms            *MiningSession
+	bufferMux     sync.Mutex
+	sharesC       chan share
+	collectorDone chan struct{}
+	cancel        context.CancelFunc
+	ended         chan struct{}
+	// Results returned by Stop
+	collected bool
+
+	paused      int32
+	pauseMux    sync.Mutex
+	pausedSince time.Time
+}
+
+func (s *session) isEnded() bool {
+	select {
+	case <-s.ended:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *session) isPaused() bool {
+	return atomic.LoadInt32(&s.paused) == 1
+}
+
+// setPaused updates the pause state and accounts for the paused time
+func (s *session) setPaused(paused bool, now time.Time) {
+	s.pauseMux.Lock()
+	defer s.pauseMux.Unlock()
+
+	if paused == s.isPaused() {
+		return
+	}
+	if paused {
+		s.pausedSince = now
+		atomic.StoreInt32(&s.paused, 1)
+	} else {
+		s.ms.PausedDuration += now.Sub(s.pausedSince)
+		atomic.StoreInt32(&s.paused, 0)
+	}
 }
 
 func NewSuperMiner(nbMiners int) *SuperMiner {
 	superMiner := new(SuperMiner)
 	superMiner.SubMinerCount = nbMiners
+	superMiner.Logger = logrus.NewEntry(log)
 	miners := make([]*Miner, nbMiners, nbMiners)
 
 	superMiner.miners = miners
@@ -50,83 +135,227 @@ func NewSuperMiner(nbMiners int) *SuperMiner {
 	return superMiner
 }
 
-func (sm *SuperMiner) Mine(oprHash []byte, noncePrefix []byte, target uint64) {
-	if sm.running {
-		log.Fatal("Tried to run an already running miner")
-	}
+// Mine starts a mining session that runs until ctx is done or Stop is called.
+// The results of a session ended by its context are still returned by Stop.
+func (sm *SuperMiner) Mine(ctx context.Context, oprHash []byte, noncePrefix []byte, target uint64) error {
+	sm.mux.Lock()
+	defer sm.mux.Unlock()
 
-	sm.running = true
+	if prev := sm.session; prev != nil {
+		if !prev.collected && !prev.isEnded() {
+			return ErrAlreadyRunning
+		}
+		// Wait for the workers of a session being stopped
+		prev.cancel()
+		<-prev.ended
+	}
 
-	sm.miningSession = new(MiningSession)
+	ms := new(MiningSession)
+	ms.Target = target
+	ms.NoncePrefix = noncePrefix
+	ms.StartTime = time.Now()
+	ms.OprHash = oprHash
+	ms.NonceBuffer = make([][]byte, 0, 300)
+	ms.MinActiveMiners = len(sm.miners)
 
-	sm.miningSession.Target = target
-	sm.miningSession.NoncePrefix = noncePrefix
-	sm.miningSession.StartTime = time.Now()
-	sm.miningSession.OprHash = oprHash
-	sm.miningSession.NonceBuffer = make([][]byte, 0, 300)
+	ctx, cancel := context.WithCancel(ctx)
+	s := &session{
+		ms:            ms,
+		sharesC:       make(chan share, 64),
+		collectorDone: make(chan struct{}),
+		cancel:        cancel,
+		ended:         make(chan struct{}),
+	}
+	sm.session = s
 
-	sm.miningSession.sharesC = make(chan []byte, 64)
-	go sm.collectShares(sm.miningSession.sharesC)
+	stopCollector := make(chan struct{})
+	go s.collectShares(stopCollector)
 
-	wg := new(sync.WaitGroup)
+	sm.statsMux.Lock()
 	for i := 0; i < len(sm.miners); i++ {
 		sm.miners[i].Reset()
-		wg.Add(1)
-		go sm.miners[i].mine(oprHash, noncePrefix, target, wg, sm.miningSession.sharesC, -1)
+		sm.miners[i].start(ctx, s)
+	}
+	sm.statsMux.Unlock()
+
+	watchdogDone := make(chan struct{})
+	go sm.watchdog(ctx, s, watchdogDone)
+
+	stopSampler := make(chan struct{})
+	samplerDone := make(chan struct{})
+	go sm.sampleHashRate(s, stopSampler, samplerDone)
+
+	throttleDone := make(chan struct{})
+	if sm.MaxLoad > 0 {
+		go sm.throttle(ctx, s, throttleDone)
+	} else {
+		close(throttleDone)
 	}
-	sm.wg = wg
+
+	go func() {
+		<-ctx.Done()
+
+		<-throttleDone
+		<-watchdogDone
+		// The watchdog is over, the workers cannot be replaced anymore
+		for i := 0; i < len(sm.miners); i++ {
+			<-sm.miners[i].done
+		}
+		close(stopSampler)
+		<-samplerDone
+
+		ms.EndTime = time.Now()
+		s.setPaused(false, ms.EndTime)
+		ms.Duration = ms.EndTime.Sub(ms.StartTime)
+		ms.ActiveDuration = ms.Duration - ms.PausedDuration - ms.ThrottledIdleDuration
+		close(stopCollector)
+		<-s.collectorDone
+
+		ms.MinerStats = sm.MinerStats()
+		for i, stats := range ms.MinerStats {
+			ms.TotalOps += stats.TotalOps
+			if best := sm.miners[i].bestDifficulty(); best > ms.BestDifficulty {
+				ms.BestDifficulty = best
+			}
+		}
+		close(s.ended)
+	}()
 
 	targetBuff := make([]byte, 8)
 	binary.BigEndian.PutUint64(targetBuff, target)
 
-	log.WithFields(logrus.Fields{
+	sm.Logger.WithFields(logrus.Fields{
 		"nbSubMiners": len(sm.miners),
 		"oprHash":     oprHash,
 		"noncePrefix": noncePrefix,
 		"target":      fmt.Sprintf("%x", targetBuff),
 	}).Infof("Starting mining session")
+
+	return nil
+}
+
+// collectShares buffers the shares found by the sub-miners.
+// The shares channel is never closed as an abandoned stalled
+// worker may still send to it after the end of the session.
+func (s *session) collectShares(stop <-chan struct{}) {
+	defer close(s.collectorDone)
+
+	collect := func(sh share) {
+		s.bufferMux.Lock()
+		s.ms.TotalShares++
+		s.ms.DifficultyHistogram[histogramBucket(s.ms.Target, sh.difficulty)]++
+		s.ms.NonceBuffer = append(s.ms.NonceBuffer, sh.nonce)
+		s.bufferMux.Unlock()
+	}
+
+	for {
+		select {
+		case sh := <-s.sharesC:
+			collect(sh)
+		case <-stop:
+			// Drain the shares sent before the miners stopped
+			for {
+				select {
+				case sh := <-s.sharesC:
+					collect(sh)
+				default:
+					return
+				}
+			}
+		}
+	}
 }
 
-func (sm *SuperMiner) collectShares(c <-chan []byte) {
-	for nonce := range c {
-		sm.miningSession.TotalShares++
-		nonceBufferMux.Lock()
-		sm.miningSession.NonceBuffer = append(sm.miningSession.NonceBuffer, nonce)
-		nonceBufferMux.Unlock()
+// MinerStats returns live statistics of the sub-miners
+func (sm *SuperMiner) MinerStats() []MinerStats {
+	sm.statsMux.Lock()
+	defer sm.statsMux.Unlock()
+
+	stats := make([]MinerStats, len(sm.miners))
+	for i, miner := range sm.miners {
+		stats[i] = miner.stats()
 	}
+	return stats
 }
 
+// ReadNonceBuffer returns and clears the shares found so far
+// by the current session
 func (sm *SuperMiner) ReadNonceBuffer() [][]byte {
-	nonceBufferMux.Lock()
-	buffer := sm.miningSession.NonceBuffer
-	sm.miningSession.NonceBuffer = make([][]byte, 0, 300)
-	nonceBufferMux.Unlock()
+	sm.mux.Lock()
+	s := sm.session
+	sm.mux.Unlock()
+
+	if s == nil {
+		return nil
+	}
+
+	s.bufferMux.Lock()
+	buffer := s.ms.NonceBuffer
+	s.ms.NonceBuffer = make([][]byte, 0, 300)
+	s.bufferMux.Unlock()
 	return buffer
 }
 
-func (sm *SuperMiner) Stop() MiningSession {
-	if !sm.running {
-		log.Fatal("Tried to stop non-running miner")
+// Stop ends the current session and returns its results
+func (sm *SuperMiner) Stop() (MiningSession, error) {
+	sm.mux.Lock()
+	s := sm.session
+	if s == nil || s.collected {
+		sm.mux.Unlock()
+		return MiningSession{}, ErrNotRunning
 	}
+	s.collected = true
+	sm.mux.Unlock()
 
-	for i := 0; i < len(sm.miners); i++ {
-		sm.miners[i].stop <- 1
-	}
+	s.cancel()
+	<-s.ended
 
-	sm.wg.Wait()
+	s.bufferMux.Lock()
+	defer s.bufferMux.Unlock()
+	return *s.ms, nil
+}
 
-	sm.running = false
-	sm.miningSession.EndTime = time.Now()
-	sm.miningSession.Duration = sm.miningSession.EndTime.Sub(sm.miningSession.StartTime)
-	close(sm.miningSession.sharesC)
+// Pause suspends the sub-miners of the running session. Their nonce position
+// and the buffered shares are kept, the paused time isn't counted in the
+// session duration.
+func (sm *SuperMiner) Pause() error {
+	return sm.setPaused(true)
+}
 
-	for i := 0; i < len(sm.miners); i++ {
-		sm.miningSession.TotalOps += sm.miners[i].opsCounter
+// Resume the sub-miners of a paused session
+func (sm *SuperMiner) Resume() error {
+	return sm.setPaused(false)
+}
+
+func (sm *SuperMiner) setPaused(paused bool) error {
+	sm.mux.Lock()
+	defer sm.mux.Unlock()
+
+	s := sm.session
+	if s == nil || s.collected || s.isEnded() {
+		return ErrNotRunning
+	}
+	if paused != s.isPaused() {
+		s.setPaused(paused, time.Now())
+		if paused {
+			sm.Logger.Info("Mining paused")
+		} else {
+			sm.Logger.Info("Mining resumed")
+		}
 	}
+	return nil
+}
+
+func (sm *SuperMiner) IsPaused() bool {
+	sm.mux.Lock()
+	defer sm.mux.Unlock()
 
-	return *sm.miningSession
+	return sm.session != nil && !sm.session.isEnded() && sm.session.isPaused()
 }
 
 func (sm *SuperMiner) IsRunning() bool {
-	return sm.running
+	sm.mux.Lock()
+	defer sm.mux.Unlock()
+
+	return sm.session != nil && !sm.session.collected && !sm.session.isEnded()
 }
@@ -0,0 +1,182 @@
+package mining
+
+import (
+	"context"
+	"math"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.com/oraxpool/orax-cli/hash"
+)
+
+func TestMain(m *testing.M) {
+	hash.InitTestLXR()
+	os.Exit(m.Run())
+}
+
+func TestMineStop(t *testing.T) {
+	require := require.New(t)
+
+	sm := NewSuperMiner(2)
+	oprHash := make([]byte, 32)
+
+	_, err := sm.Stop()
+	require.Equal(ErrNotRunning, err)
+
+	require.NoError(sm.Mine(context.Background(), oprHash, []byte{1, 2}, 0))
+	require.True(sm.IsRunning())
+	require.Equal(ErrAlreadyRunning, sm.Mine(context.Background(), oprHash, []byte{1, 2}, 0))
+
+	time.Sleep(50 * time.Millisecond)
+	ms, err := sm.Stop()
+	require.NoError(err)
+	require.False(sm.IsRunning())
+	require.True(ms.TotalOps > 0)
+	// With a zero target every hash is a share
+	require.Equal(ms.TotalOps, ms.TotalShares)
+	require.Len(ms.MinerStats, 2)
+
+	_, err = sm.Stop()
+	require.Equal(ErrNotRunning, err)
+}
+
+func TestMineContextCancel(t *testing.T) {
+	require := require.New(t)
+
+	sm := NewSuperMiner(2)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	require.NoError(sm.Mine(ctx, make([]byte, 32), []byte{1, 2}, math.MaxUint64))
+	<-ctx.Done()
+	for i := 0; sm.IsRunning() && i < 100; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.False(sm.IsRunning())
+
+	ms, err := sm.Stop()
+	require.NoError(err)
+	require.True(ms.TotalOps > 0)
+	require.True(ms.Duration >= 50*time.Millisecond)
+
+	// A new session can start after a session ended by its context
+	require.NoError(sm.Mine(context.Background(), make([]byte, 32), []byte{1, 2}, math.MaxUint64))
+	_, err = sm.Stop()
+	require.NoError(err)
+}
+
+func TestConcurrentAccess(t *testing.T) {
+	sm := NewSuperMiner(4)
+	oprHash := make([]byte, 32)
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				sm.IsRunning()
+				sm.ReadNonceBuffer()
+				sm.MinerStats()
+			}
+		}()
+	}
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if sm.Mine(context.Background(), oprHash, []byte{1, 2}, 1<<63) == nil {
+					time.Sleep(5 * time.Millisecond)
+				}
+				sm.Stop()
+			}
+		}()
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	close(done)
+	wg.Wait()
+}
+
+func TestConcurrentSuperMiners(t *testing.T) {
+	require := require.New(t)
+
+	a, b := NewSuperMiner(2), NewSuperMiner(2)
+	require.NoError(a.Mine(context.Background(), make([]byte, 32), []byte{1}, 1<<62))
+	require.NoError(b.Mine(context.Background(), make([]byte, 32), []byte{2}, 1<<62))
+	time.Sleep(50 * time.Millisecond)
+
+	msA, err := a.Stop()
+	require.NoError(err)
+	require.True(b.IsRunning())
+	msB, err := b.Stop()
+	require.NoError(err)
+
+	require.True(msA.TotalOps > 0)
+	require.True(msB.TotalOps > 0)
+	// Each miner only buffers shares of its own nonce space
+	for _, nonce := range msA.NonceBuffer {
+		require.Equal(byte(1), nonce[0])
+	}
+	for _, nonce := range msB.NonceBuffer {
+		require.Equal(byte(2), nonce[0])
+	}
+}
+
+func TestPauseResume(t *testing.T) {
+	require := require.New(t)
+
+	sm := NewSuperMiner(2)
+	require.Equal(ErrNotRunning, sm.Pause())
+
+	require.NoError(sm.Mine(context.Background(), make([]byte, 32), []byte{1, 2}, 1<<62))
+	time.Sleep(20 * time.Millisecond)
+	require.NoError(sm.Pause())
+	require.True(sm.IsPaused())
+
+	// Let the workers finish their current batch
+	time.Sleep(2 * idlePollInterval)
+	ops := sm.MinerStats()[0].TotalOps
+	time.Sleep(2 * idlePollInterval)
+	require.Equal(ops, sm.MinerStats()[0].TotalOps)
+
+	require.NoError(sm.Resume())
+	require.False(sm.IsPaused())
+	time.Sleep(2 * idlePollInterval)
+
+	ms, err := sm.Stop()
+	require.NoError(err)
+	require.True(ms.MinerStats[0].TotalOps > ops)
+	require.True(ms.PausedDuration >= 4*idlePollInterval)
+	require.Equal(ms.EndTime.Sub(ms.StartTime), ms.Duration)
+	require.Equal(ms.Duration-ms.PausedDuration, ms.ActiveDuration)
+}
+
+func TestHashRate(t *testing.T) {
+	require := require.New(t)
+
+	sm := NewSuperMiner(2)
+	require.Equal(int64(0), sm.HashRate())
+
+	require.NoError(sm.Mine(context.Background(), make([]byte, 32), []byte{1, 2}, math.MaxUint64))
+	time.Sleep(50 * time.Millisecond)
+	ms, err := sm.Stop()
+	require.NoError(err)
+
+	// The rate is only measured on mining time
+	expected := float64(ms.TotalOps) / ms.ActiveDuration.Seconds()
+	require.InEpsilon(expected, float64(sm.HashRate()), 0.2)
+	time.Sleep(20 * time.Millisecond)
+	require.InEpsilon(expected, float64(sm.HashRate()), 0.2)
+}
@@ -0,0 +1,163 @@
+package mining
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Non mining load must drop this much below the maximum before resuming a sub-miner
+const throttleResumeMargin = 0.5
+
+// Shortened by tests
+var throttleCheckInterval = 5 * time.Second
+
+// processThrottle is shared by the super miners of the process. The CPU
+// time of the process accounts for all of them and its smoothing carries
+// over from a session to the next, while the load above the maximum is
+// split between the super miners being throttled.
+var processThrottle = &throttleGroup{miners: make(map[*SuperMiner]int)}
+
+type throttleGroup struct {
+	sampler loadSampler
+
+	mux sync.Mutex
+	// Sub-miners of the super miners being throttled
+	miners map[*SuperMiner]int
+}
+
+func (g *throttleGroup) join(sm *SuperMiner) {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	g.miners[sm] = len(sm.miners)
+}
+
+func (g *throttleGroup) leave(sm *SuperMiner) {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	delete(g.miners, sm)
+}
+
+// share returns the part of the sub-miners being throttled run by sm
+func (g *throttleGroup) share(sm *SuperMiner) float64 {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+
+	total := 0
+	for _, n := range g.miners {
+		total += n
+	}
+	if total == 0 {
+		return 1
+	}
+	return float64(g.miners[sm]) / float64(total)
+}
+
+// throttle periodically adjusts the number of active sub-miners
+// so that the load not caused by mining stays under sm.MaxLoad.
+func (sm *SuperMiner) throttle(ctx context.Context, s *session, done chan<- struct{}) {
+	defer close(done)
+	ms := s.ms
+
+	sampler := &processThrottle.sampler
+	if _, err := sampler.nonMiningLoad(); err != nil {
+		sm.Logger.WithError(err).Warn("Load-aware throttling unavailable on this system")
+		return
+	}
+	processThrottle.join(sm)
+	defer processThrottle.leave(sm)
+
+	ticker := time.NewTicker(throttleCheckInterval)
+	defer ticker.Stop()
+
+	active := len(sm.miners)
+	var throttledSince time.Time
+	// The idle sub-miners are accounted as long as the session isn't paused,
+	// the paused time being already excluded from the duration
+	lastCheck := time.Now()
+	accountIdle := func() {
+		now := time.Now()
+		if !s.isPaused() {
+			ms.ThrottledIdleDuration += now.Sub(lastCheck) * time.Duration(len(sm.miners)-active) / time.Duration(len(sm.miners))
+		}
+		lastCheck = now
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			accountIdle()
+			if !throttledSince.IsZero() {
+				ms.ThrottledDuration += time.Since(throttledSince)
+			}
+			return
+		case <-ticker.C:
+		}
+		accountIdle()
+
+		load, err := sampler.nonMiningLoad()
+		if err != nil {
+			sm.Logger.WithError(err).Warn("Failed to sample system load")
+			continue
+		}
+
+		target := throttleTarget(active, len(sm.miners), load, sm.MaxLoad, processThrottle.share(sm))
+		if target == active {
+			continue
+		}
+
+		sm.setActiveMiners(target)
+		ms.ThrottleAdjustments++
+		if target < ms.MinActiveMiners {
+			ms.MinActiveMiners = target
+		}
+
+		if target < len(sm.miners) && throttledSince.IsZero() {
+			throttledSince = time.Now()
+		} else if target == len(sm.miners) && !throttledSince.IsZero() {
+			ms.ThrottledDuration += time.Since(throttledSince)
+			throttledSince = time.Time{}
+		}
+
+		fields := logrus.Fields{
+			"nonMiningLoad": math.Round(load*100) / 100,
+			"maxLoad":       sm.MaxLoad,
+			"activeMiners":  target,
+		}
+		if target < active {
+			sm.Logger.WithFields(fields).Info("System load too high, throttling mining")
+		} else {
+			sm.Logger.WithFields(fields).Info("System load decreased, resuming sub-miner")
+		}
+		active = target
+	}
+}
+
+// throttleTarget returns the number of sub-miners to keep active out of total
+// for the non mining load to stay under maxLoad. One sub-miner is idled per
+// load unit above the maximum, and they are resumed one at a time. The super
+// miner only takes its share of the excess load when several ones are throttled.
+func throttleTarget(active int, total int, load float64, maxLoad float64, share float64) int {
+	excess := (load - maxLoad) * share
+	if excess > 0 {
+		target := active - int(math.Ceil(excess))
+		if target < 0 {
+			return 0
+		}
+		return target
+	}
+	// The super miners resume a sub-miner each at the same time,
+	// the load must leave the margin to every one of them
+	if excess <= -throttleResumeMargin && active < total {
+		return active + 1
+	}
+	return active
+}
+
+func (sm *SuperMiner) setActiveMiners(n int) {
+	for i, miner := range sm.miners {
+		miner.setIdle(i >= n)
+	}
+}
@@ -0,0 +1,88 @@
+package mining
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestThrottleTarget(t *testing.T) {
+	tests := []struct {
+		name    string
+		active  int
+		load    float64
+		maxLoad float64
+		share   float64
+		target  int
+	}{
+		{"under the maximum", 8, 1, 2, 1, 8},
+		{"just above the maximum", 8, 2.1, 2, 1, 7},
+		{"one sub-miner per load unit", 8, 4.5, 2, 1, 5},
+		{"all idled", 2, 6, 2, 1, 0},
+		{"within the resume margin", 5, 1.7, 2, 1, 5},
+		{"resumed one at a time", 5, 0.2, 2, 1, 6},
+		{"all active", 8, 0, 2, 1, 8},
+		{"at the maximum", 6, 2, 2, 1, 6},
+		{"share of the excess load", 8, 6, 2, 0.25, 7},
+		{"within the margin of both super miners", 5, 1.2, 2, 0.5, 5},
+		{"resumed by both super miners", 5, 0.9, 2, 0.5, 6},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.target, throttleTarget(test.active, 8, test.load, test.maxLoad, test.share))
+		})
+	}
+}
+
+func TestThrottleGroupShare(t *testing.T) {
+	require := require.New(t)
+
+	group := &throttleGroup{miners: make(map[*SuperMiner]int)}
+	sm1, sm2 := NewSuperMiner(2), NewSuperMiner(6)
+	group.join(sm1)
+	require.Equal(1.0, group.share(sm1))
+	group.join(sm2)
+	require.Equal(0.25, group.share(sm1))
+	require.Equal(0.75, group.share(sm2))
+	group.leave(sm2)
+	require.Equal(1.0, group.share(sm1))
+}
+
+// The load of the previous session isn't mistaken for a non mining load
+func TestThrottleBackToBackSessions(t *testing.T) {
+	require := require.New(t)
+
+	defer func(interval time.Duration, read func() (float64, time.Duration, error)) {
+		throttleCheckInterval, readLoad = interval, read
+	}(throttleCheckInterval, readLoad)
+	throttleCheckInterval = 10 * time.Millisecond
+
+	// The process has been mining on 2 CPUs for long, causing all the load
+	start := time.Now()
+	readLoad = func() (float64, time.Duration, error) {
+		return 2, 2 * time.Since(start), nil
+	}
+	sampler := &processThrottle.sampler
+	sampler.mux.Lock()
+	sampler.lastSample, sampler.lastCPUTime, sampler.processLoad = start, 0, 2
+	sampler.mux.Unlock()
+	defer func() {
+		sampler.mux.Lock()
+		sampler.lastSample, sampler.lastCPUTime, sampler.processLoad = time.Time{}, 0, 0
+		sampler.mux.Unlock()
+	}()
+
+	sm := NewSuperMiner(2)
+	sm.MaxLoad = 1
+	for i := 0; i < 2; i++ {
+		require.NoError(sm.Mine(context.Background(), make([]byte, 32), []byte{1, 2}, math.MaxUint64))
+		time.Sleep(10 * throttleCheckInterval)
+		ms, err := sm.Stop()
+		require.NoError(err)
+		require.Zero(ms.ThrottleAdjustments, "session %d", i+1)
+		time.Sleep(5 * throttleCheckInterval)
+	}
+}
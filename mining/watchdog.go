@@ -0,0 +1,73 @@
+package mining
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	stallCheckInterval = 10 * time.Second
+	// Duration without any hash computed after which a sub-miner is considered stalled
+	stallTimeout = time.Minute
+)
+
+// watchdog records the progress of the sub-miners and
+// detects the ones that stopped hashing
+func (sm *SuperMiner) watchdog(ctx context.Context, s *session, done chan<- struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(stallCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			sm.statsMux.Lock()
+			for _, miner := range sm.miners {
+				sm.checkProgress(ctx, s, miner, now)
+			}
+			sm.statsMux.Unlock()
+		}
+	}
+}
+
+func (sm *SuperMiner) checkProgress(ctx context.Context, s *session, miner *Miner, now time.Time) {
+	ops := miner.totalOps()
+	// Throttled or paused miners are not expected to progress
+	if ops != miner.lastOps || miner.isIdle() || s.isPaused() {
+		if miner.stalled {
+			sm.Logger.WithField("subMiner", miner.id).Info("Sub-miner resumed progress")
+		}
+		miner.lastOps = ops
+		miner.lastProgress = now
+		miner.stalled = false
+		return
+	}
+
+	if miner.stalled || now.Sub(miner.lastProgress) < stallTimeout {
+		return
+	}
+
+	miner.stalled = true
+	logger := sm.Logger.WithFields(logrus.Fields{
+		"subMiner":     miner.id,
+		"totalOps":     ops,
+		"lastProgress": miner.lastProgress.Format(time.RFC3339),
+	})
+
+	if !sm.RestartStalled || miner.generation == 255 {
+		logger.Warn("Sub-miner stalled")
+		return
+	}
+
+	// The stuck goroutine cannot be killed: signal it to stop
+	// whenever it recovers and start a fresh worker without waiting for it
+	logger.Warn("Sub-miner stalled, restarting it")
+	miner.restart(ctx, s)
+	miner.lastProgress = now
+	miner.stalled = false
+}
@@ -0,0 +1,102 @@
+package mining
+
+import (
+	"context"
+	"math"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// frozenWorker stands for a worker stuck without hashing
+func frozenWorker(miner *Miner) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	miner.cancel = cancel
+	miner.done = make(chan struct{})
+	return ctx
+}
+
+func TestStallDetection(t *testing.T) {
+	require := require.New(t)
+
+	sm := NewSuperMiner(1)
+	miner := sm.miners[0]
+	miner.Reset()
+	frozenWorker(miner)
+	s := &session{ms: new(MiningSession)}
+
+	now := time.Now()
+	atomic.AddInt64(&miner.counters.ops, 100)
+	sm.checkProgress(context.Background(), s, miner, now)
+	sm.checkProgress(context.Background(), s, miner, now.Add(stallTimeout/2))
+	require.False(miner.stats().Stalled)
+
+	// Without restart the stalled sub-miner is only reported
+	sm.checkProgress(context.Background(), s, miner, now.Add(stallTimeout))
+	stats := miner.stats()
+	require.True(stats.Stalled)
+	require.Equal(0, stats.Restarts)
+	require.Equal(now, stats.LastProgress)
+
+	atomic.AddInt64(&miner.counters.ops, 1)
+	sm.checkProgress(context.Background(), s, miner, now.Add(2*stallTimeout))
+	require.False(miner.stats().Stalled)
+
+	// Idle sub-miners aren't expected to progress
+	miner.setIdle(true)
+	sm.checkProgress(context.Background(), s, miner, now.Add(4*stallTimeout))
+	require.False(miner.stats().Stalled)
+}
+
+func TestStalledWorkerRestart(t *testing.T) {
+	require := require.New(t)
+
+	sm := NewSuperMiner(1)
+	sm.RestartStalled = true
+	miner := sm.miners[0]
+	miner.Reset()
+	frozen := frozenWorker(miner)
+	stuck := miner.counters
+	atomic.AddInt64(&stuck.ops, 100)
+	atomic.AddInt64(&stuck.shares, 2)
+	atomic.StoreUint64(&stuck.best, 1000)
+
+	s := &session{
+		ms:            &MiningSession{OprHash: make([]byte, 32), NoncePrefix: []byte{1, 2}, Target: math.MaxUint64},
+		sharesC:       make(chan share),
+		collectorDone: make(chan struct{}),
+	}
+	close(s.collectorDone)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	now := time.Now()
+	sm.checkProgress(ctx, s, miner, now)
+	sm.checkProgress(ctx, s, miner, now.Add(stallTimeout))
+
+	// The frozen worker is told to stop and replaced
+	require.Error(frozen.Err())
+	stats := miner.stats()
+	require.False(stats.Stalled)
+	require.Equal(1, stats.Restarts)
+	require.True(stats.TotalOps >= 100)
+	require.True(stats.TotalShares >= 2)
+	require.True(miner.bestDifficulty() >= 1000)
+
+	// Once stopped, the new worker alone is accounted
+	for atomic.LoadInt64(&miner.counters.ops) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-miner.done
+	ops := miner.totalOps()
+	require.True(ops > 100)
+	require.Equal(ops-100, atomic.LoadInt64(&miner.counters.ops))
+
+	// whatever the frozen worker does when it recovers
+	atomic.AddInt64(&stuck.ops, 1000)
+	atomic.AddInt64(&stuck.shares, 10)
+	require.Equal(ops, miner.totalOps())
+	require.Equal(ops, miner.stats().TotalOps)
+}
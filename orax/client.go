@@ -1,20 +1,22 @@
 package orax
 
 import (
+	"context"
 	"encoding/binary"
 	"fmt"
 	"math"
 	"math/rand"
+	"sync"
 	"time"
 
-	flatbuffers "github.com/google/flatbuffers/go"
 	"github.com/sirupsen/logrus"
 
 	"gitlab.com/oraxpool/orax-cli/common"
-	"gitlab.com/oraxpool/orax-message/msg"
 	"gitlab.com/oraxpool/orax-message/msg/fbs"
 
 	"gitlab.com/oraxpool/orax-cli/mining"
+	"gitlab.com/oraxpool/orax-cli/protocol"
+	"gitlab.com/oraxpool/orax-cli/trace"
 	"gitlab.com/oraxpool/orax-cli/ws"
 )
 
@@ -22,11 +24,38 @@ var (
 	log = common.GetLog()
 )
 
+// Mining time needed for a first estimation of the hash rate
+const warmUpDuration = 10 * time.Second
+
 type Client struct {
+	logger             *logrus.Entry
 	wscli              *ws.Client
 	miner              *mining.SuperMiner
+	schedule           *Schedule
 	stopClaimingShares chan struct{}
 
+	// Submission stats of the current session and the submits
+	// of the connection waiting for their acknowledgment
+	sharesMux      sync.Mutex
+	shares         *shareStats
+	queuedSubmits  []queuedSubmit
+	pendingSubmits map[int64]pendingSubmit
+	// The orchestrator acknowledges the submits of the connection
+	acknowledging bool
+	endedSessions []endedSession
+
+	// Mining paused by the orchestrator, pauseExpired
+	// fires when the pause has a duration
+	serverPaused bool
+	pauseExpired <-chan time.Time
+	// Set by a Shutdown message of the orchestrator
+	shuttingDown bool
+	// Features of the protocol enabled for the connection
+	features map[string]bool
+
+	// The state file is read-only, hash rates are only kept in memory
+	hashRateNotPersisted bool
+
 	// Mining params
 	CurrentTarget     uint64
 	NoncePrefix       []byte
@@ -35,34 +64,99 @@ type Client struct {
 }
 
 type ClientConfig struct {
+	// Name of the miner among the ones of the process, added to its logs
+	Name string
+	// Miner identity and orchestrator endpoint, default to the ones of the config file
+	MinerID     string
+	MinerSecret string
+	Endpoint    string
+
 	NbMiners int
+	MaxLoad  float64
+	// Restart stalled sub-miners
+	RestartStalled bool
+	// Mining windows, nil to mine at any time
+	Schedule *Schedule
+	// Records the protocol frames, nil to disable
+	Trace *trace.Recorder
+	// Connect right away without measuring the hash rate first
+	SkipWarmUp bool
 }
 
 func (cli *Client) Start(config ClientConfig, stop <-chan struct{}) <-chan struct{} {
-	done := make(chan struct{})
+	return StartClients([]*Client{cli}, []ClientConfig{config}, stop)[0]
+}
 
-	// Initialize super miner
-	cli.miner = mining.NewSuperMiner(config.NbMiners)
+// StartClients starts clients mining on the same machine. If any lacks an
+// indicative hash rate, they are all warmed up together before connecting
+// so that each measure accounts for the load of the others.
+func StartClients(clients []*Client, configs []ClientConfig, stop <-chan struct{}) []<-chan struct{} {
+	warmUp := false
+	for i, cli := range clients {
+		cli.init(configs[i])
+		if !configs[i].SkipWarmUp && common.GetIndicativeHashRate(configs[i].NbMiners) == 0 {
+			warmUp = true
+		}
+	}
+	if warmUp {
+		warmUpClients(clients)
+	}
 
-	if common.GetIndicativeHashRate(config.NbMiners) == 0 {
-		cli.benchHashRate()
+	dones := make([]<-chan struct{}, len(clients))
+	for i, cli := range clients {
+		done := make(chan struct{})
+		go func(cli *Client) {
+			defer close(done)
+			cli.run(stop)
+		}(cli)
+		dones[i] = done
 	}
+	return dones
+}
 
-	// Initialize Websocket client
-	cli.wscli = ws.NewWebSocketClient(config.NbMiners)
+// Err returns the reason the client stopped on its own once done,
+// nil if it was stopped or shut down by the orchestrator
+func (cli *Client) Err() error {
+	return cli.wscli.Err()
+}
 
-	go func() {
-		defer close(done)
-		cli.run(stop)
-	}()
+func (cli *Client) init(config ClientConfig) {
+	cli.logger = logrus.NewEntry(log)
+	if config.Name != "" {
+		cli.logger = log.WithField("miner", config.Name)
+	}
 
-	return done
+	// Initialize super miner
+	cli.miner = mining.NewSuperMiner(config.NbMiners)
+	cli.miner.Logger = cli.logger
+	cli.miner.MaxLoad = config.MaxLoad
+	cli.miner.RestartStalled = config.RestartStalled
+	cli.schedule = config.Schedule
+	cli.shares = new(shareStats)
+	cli.pendingSubmits = make(map[int64]pendingSubmit)
+
+	// Initialize Websocket client
+	cli.wscli = ws.NewWebSocketClient(config.NbMiners)
+	cli.wscli.Name = config.Name
+	cli.wscli.Logger = cli.logger
+	if config.MinerID != "" {
+		cli.wscli.MinerID = config.MinerID
+		cli.wscli.MinerSecret = config.MinerSecret
+	}
+	if config.Endpoint != "" {
+		cli.wscli.Endpoint = config.Endpoint
+	}
+	cli.wscli.HashRate = cli.hashRate
+	cli.wscli.Sent = cli.submitWritten
+	cli.wscli.Trace = config.Trace
 }
 
 func (cli *Client) run(stop <-chan struct{}) {
 	stopServer := make(chan struct{})
 	doneServer := cli.wscli.Start(stopServer)
 
+	scheduleTimer := cli.newScheduleTimer()
+
 	for {
 		select {
 		case received, ok := <-cli.wscli.Receive:
@@ -70,17 +164,24 @@ func (cli *Client) run(stop <-chan struct{}) {
 				return
 			}
 			cli.handleMessage(received)
+			if cli.shuttingDown {
+				cli.shutdown(stopServer, doneServer)
+				return
+			}
 		case coInfo, ok := <-cli.wscli.Connected:
 			if !ok {
 				return
 			}
 
+			cli.setAcknowledging(coInfo.Features[protocol.FeatureSubmitAck])
+			cli.features = coInfo.Features
+
 			// Populate connection information
 			cli.NoncePrefix = coInfo.NoncePrefix
 			cli.CurrentTarget = coInfo.Target
 			cli.BatchingDuration = coInfo.BatchingDuration
 			cli.InitialBatchDelay = coInfo.InitialBatchDelay
-			log.WithField("params", coInfo).Info("Connected to Orax orchestrator")
+			cli.logger.WithField("params", coInfo).Info("Connected to Orax orchestrator")
 		case _, ok := <-cli.wscli.Disconnected:
 			if !ok {
 				return
@@ -89,67 +190,177 @@ func (cli *Client) run(stop <-chan struct{}) {
 			// If we lost the connection with the server
 			// stop mining and claiming shares
 			cli.stopClaimingShareBatches()
-			if cli.miner.IsRunning() {
-				cli.miner.Stop()
+			if ms, err := cli.miner.Stop(); err == nil {
+				cli.endMiningSession(&ms)
+			}
+			// The acknowledgments of the lost connection won't come
+			cli.flushEndedSessions()
+		case <-scheduleTimer.C:
+			// Pause the running session outside of the schedule but keep
+			// the connection and the shares found so far
+			if cli.schedule.Allowed(time.Now()) {
+				cli.logger.Info("Entering mining schedule window")
+				if !cli.serverPaused {
+					cli.miner.Resume()
+				}
+			} else {
+				cli.logger.Info("Leaving mining schedule window")
+				cli.miner.Pause()
 			}
+			scheduleTimer = cli.newScheduleTimer()
+		case <-cli.pauseExpired:
+			cli.logger.Info("Pause requested by the orchestrator expired")
+			cli.resumeFromServer()
 		case <-stop:
-			// Stop mining and send results
-			cli.submitMiningResult(time.Duration(0))
-
-			// Stop WS server
-			close(stopServer)
-			<-doneServer
+			cli.shutdown(stopServer, doneServer)
 			return
 		}
 	}
 }
 
+// shutdown sends the results of the running session and disconnects
+func (cli *Client) shutdown(stopServer chan struct{}, doneServer <-chan struct{}) {
+	// Stop mining and send results
+	cli.submitMiningResult(time.Duration(0))
+	// Don't wait for the acknowledgment of the last shares
+	cli.sharesMux.Lock()
+	cli.acknowledging = false
+	cli.sharesMux.Unlock()
+	cli.flushEndedSessions()
+
+	// Stop WS server
+	close(stopServer)
+	<-doneServer
+}
+
 func (cli *Client) handleMessage(received []byte) {
-	message, err := msg.UnmarshalMessage(received)
+	message, err := protocol.UnmarshalMessage(received)
 	if err != nil {
-		log.WithError(err).Error("Failed to unmarshal message")
+		cli.logger.WithError(err).Error("Failed to unmarshal message")
 		return
 	}
 
+	switch message.(type) {
+	case *protocol.PauseMessage, *protocol.ResumeMessage, *protocol.ReconnectMessage, *protocol.ShutdownMessage:
+		if !cli.features[protocol.FeatureControl] {
+			cli.logger.Warnf("Ignoring %T, control messages weren't enabled for the connection", message)
+			return
+		}
+	}
+
 	switch v := message.(type) {
 	case *fbs.StartMiningMessage:
-		if cli.miner.IsRunning() {
-			log.Warn("Stopping a stalled mining session")
-			cli.miner.Stop()
+		if ms, err := cli.miner.Stop(); err == nil {
+			cli.logger.Warn("Stopped a stalled mining session")
+			cli.endMiningSession(&ms)
+		}
+		cli.flushEndedSessions()
+		if !cli.schedule.Allowed(time.Now()) {
+			cli.logger.Info("Skipping mining session outside of the mining schedule")
+			return
+		}
+		cli.startShareAccounting()
+		err := cli.miner.Mine(context.Background(), v.OprHashBytes(), cli.NoncePrefix, cli.CurrentTarget)
+		if err != nil {
+			cli.logger.WithError(err).Error("Failed to start mining session")
+			return
+		}
+		// Ready to resume within the window
+		if cli.serverPaused {
+			cli.miner.Pause()
 		}
 		cli.startClaimingShareBatches()
-		cli.miner.Mine(v.OprHashBytes(), cli.NoncePrefix, cli.CurrentTarget)
 	case *fbs.SubmissionWindowClosingMessage:
 		cli.submitMiningResult(time.Duration(v.Deadline()) * time.Second)
 	case *fbs.SetTargetMessage:
 		cli.CurrentTarget = v.Target()
-		log.Infof("New target set: %d", cli.CurrentTarget)
+		cli.logger.Infof("New target set: %d", cli.CurrentTarget)
+	case *protocol.SubmitAckMessage:
+		cli.handleSubmitAck(v)
+	case *protocol.PauseMessage:
+		cli.pauseFromServer(v)
+	case *protocol.ResumeMessage:
+		cli.resumeFromServer()
+	case *protocol.ReconnectMessage:
+		// Sent between mining sessions, the shares of a running one
+		// are submitted before leaving the connection
+		cli.logger.WithFields(logrus.Fields{
+			"endpoint": v.Endpoint,
+			"delay":    v.Delay,
+			"reason":   v.Reason,
+		}).Warn("Reconnecting at the request of the orchestrator")
+		cli.submitMiningResult(time.Duration(0))
+		cli.wscli.Reconnect(v.Endpoint, time.Duration(v.Delay)*time.Second)
+	case *protocol.ShutdownMessage:
+		cli.logger.WithField("reason", v.Reason).Warn("Shutting down at the request of the orchestrator")
+		cli.shuttingDown = true
 	default:
-		log.Warnf("Unexpected message %T!\n", v)
+		cli.logger.Warnf("Unexpected message %T!\n", v)
 	}
 }
 
+// pauseFromServer pauses the running session and the ones
+// started until the orchestrator resumes mining
+func (cli *Client) pauseFromServer(pause *protocol.PauseMessage) {
+	cli.serverPaused = true
+	cli.pauseExpired = nil
+	fields := logrus.Fields{"reason": pause.Reason}
+	if pause.Duration > 0 {
+		cli.pauseExpired = time.After(time.Duration(pause.Duration) * time.Second)
+		fields["duration"] = time.Duration(pause.Duration) * time.Second
+	}
+	cli.logger.WithFields(fields).Warn("Mining paused by the orchestrator")
+	cli.miner.Pause()
+}
+
+func (cli *Client) resumeFromServer() {
+	if !cli.serverPaused {
+		return
+	}
+	cli.serverPaused = false
+	cli.pauseExpired = nil
+	if !cli.schedule.Allowed(time.Now()) {
+		cli.logger.Info("Mining resumed by the orchestrator, waiting for the mining schedule window")
+		return
+	}
+	cli.logger.Info("Mining resumed by the orchestrator")
+	cli.miner.Resume()
+}
+
+// newScheduleTimer returns a timer firing at the next mining schedule transition.
+// Its channel never fires if there is no schedule.
+func (cli *Client) newScheduleTimer() *time.Timer {
+	transitions := cli.schedule.NextTransitions(time.Now(), 1)
+	if len(transitions) == 0 {
+		return &time.Timer{}
+	}
+	return time.NewTimer(time.Until(transitions[0].Time))
+}
+
 func (cli *Client) startClaimingShareBatches() {
 	cli.stopClaimingShareBatches()
 
-	cli.stopClaimingShares = make(chan struct{})
+	// The run loop replaces these fields while the batches are claimed
+	stop := make(chan struct{})
+	cli.stopClaimingShares = stop
+	initialBatchDelay, batchingDuration := cli.InitialBatchDelay, cli.BatchingDuration
 	go func() {
-		timer := time.NewTimer(cli.InitialBatchDelay)
+		timer := time.NewTimer(initialBatchDelay)
 		select {
 		case <-timer.C:
-		case <-cli.stopClaimingShares:
+		case <-stop:
 			timer.Stop()
 			return
 		}
 
 		cli.claimShareBatch()
 
-		ticker := time.NewTicker(cli.BatchingDuration)
+		ticker := time.NewTicker(batchingDuration)
 		for {
 			select {
 			case <-ticker.C:
 				cli.claimShareBatch()
-			case <-cli.stopClaimingShares:
+			case <-stop:
 				ticker.Stop()
 				return
 			}
@@ -167,13 +378,8 @@ func (cli *Client) stopClaimingShareBatches() {
 func (cli *Client) claimShareBatch() {
 	if cli.miner.IsRunning() {
 		nonces := cli.miner.ReadNonceBuffer()
-		if len(nonces) > 0 {
-			data := msg.NewSubmitMessage(flatbuffers.NewBuilder(1024), nonces)
-			select {
-			case cli.wscli.Send <- data:
-			default:
-				log.Error("Skipping sending shares as Send channel is not available")
-			}
+		if len(nonces) > 0 && !cli.sendShares(nonces) {
+			cli.logger.Error("Skipping sending shares as Send channel is not available")
 		}
 	}
 }
@@ -181,9 +387,7 @@ func (cli *Client) claimShareBatch() {
 func (cli *Client) submitMiningResult(windowDuration time.Duration) {
 	cli.stopClaimingShareBatches()
 
-	if cli.miner.IsRunning() {
-		ms := cli.miner.Stop()
-
+	if ms, err := cli.miner.Stop(); err == nil {
 		// Flush residual nonces
 		if len(ms.NonceBuffer) > 0 {
 			// Randomly delay the reply within acceptable time window
@@ -194,51 +398,111 @@ func (cli *Client) submitMiningResult(windowDuration time.Duration) {
 			timer := time.NewTimer(jitter)
 			<-timer.C
 
-			data := msg.NewSubmitMessage(flatbuffers.NewBuilder(1024), ms.NonceBuffer)
-
-			select {
-			case cli.wscli.Send <- data:
-			default:
-				log.Error("Skipping sending mining result as Send channel is not available")
+			if !cli.sendShares(ms.NonceBuffer) {
+				cli.logger.Error("Skipping sending mining result as Send channel is not available")
 			}
 		}
 
-		logMiningSession(&ms)
+		cli.logMiningSession(&ms)
+		cli.endMiningSession(&ms)
 
-		err := common.SaveIndicativeHashRate(cli.miner.SubMinerCount, ms.TotalOps, ms.Duration)
-		if err != nil {
-			log.WithError(err).Warn("Failed to save indicative hash rate")
+		err := common.SaveIndicativeHashRate(cli.miner.SubMinerCount, ms.TotalOps, ms.ActiveDuration)
+		if err != nil && !cli.hashRateNotPersisted {
+			cli.hashRateNotPersisted = true
+			cli.logger.WithError(err).Warn("Failed to save indicative hash rate, keeping it in memory only")
 		}
-		log.Info("Waiting for next mining session...")
+		cli.logger.Info("Waiting for next mining session...")
 	}
 }
 
-func logMiningSession(ms *mining.MiningSession) {
+func (cli *Client) logMiningSession(ms *mining.MiningSession) {
 	targetBuff := make([]byte, 8)
 	binary.BigEndian.PutUint64(targetBuff, ms.Target)
 
-	log.WithFields(logrus.Fields{
-		"duration": ms.Duration,
-		"shares":   ms.TotalShares,
-		"target":   fmt.Sprintf("%x", targetBuff),
-	}).Infof("End of mining session")
+	bestBuff := make([]byte, 8)
+	binary.BigEndian.PutUint64(bestBuff, ms.BestDifficulty)
+
+	fields := logrus.Fields{
+		"duration":       ms.Duration,
+		"shares":         ms.TotalShares,
+		"expectedShares": math.Round(ms.ExpectedShares()*10) / 10,
+		"target":         fmt.Sprintf("%x", targetBuff),
+		"bestDifficulty": fmt.Sprintf("%x", bestBuff),
+	}
+	if ms.TotalShares > 0 {
+		fields["distribution"] = ms.DifficultyDistribution()
+	}
+	if ms.PausedDuration > 0 {
+		fields["pausedDuration"] = ms.PausedDuration
+	}
+	if ms.ActiveDuration != ms.Duration {
+		fields["activeDuration"] = ms.ActiveDuration
+	}
+	if latency := cli.wscli.Stats().Latency; latency > 0 {
+		fields["latency"] = latency.Round(time.Millisecond)
+	}
+	if ms.ThrottleAdjustments > 0 {
+		fields["throttleAdjustments"] = ms.ThrottleAdjustments
+		fields["minActiveMiners"] = ms.MinActiveMiners
+		fields["throttledDuration"] = ms.ThrottledDuration
+	}
+
+	cli.logger.WithFields(fields).Infof("End of mining session")
+
+	for _, stats := range ms.MinerStats {
+		minerLog := cli.logger.WithFields(logrus.Fields{
+			"subMiner":     stats.ID,
+			"ops":          stats.TotalOps,
+			"shares":       stats.TotalShares,
+			"lastProgress": stats.LastProgress.Format(time.RFC3339),
+		})
+		if stats.Stalled || stats.Restarts > 0 {
+			minerLog.WithField("restarts", stats.Restarts).Warn("Sub-miner stalled during the session")
+		} else {
+			minerLog.Debug("Sub-miner stats")
+		}
+	}
+
+	if ms.UnderFinding() {
+		cli.logger.Warn("Found far fewer shares than expected for the number of hashes computed, the LXR hash table may be corrupted")
+	}
+}
+
+// hashRate is the hash rate measured over the latest minute of mining,
+// or the indicative hash rate of past sessions if the miner hasn't mined yet
+func (cli *Client) hashRate() int64 {
+	if hashRate := cli.miner.HashRate(); hashRate > 0 {
+		return hashRate
+	}
+	return common.GetIndicativeHashRate(cli.miner.SubMinerCount)
 }
 
-func (cli *Client) benchHashRate() {
+// warmUpClients mines briefly with all the clients at once
+// to get a first estimation of their hash rates
+func warmUpClients(clients []*Client) {
 	log.Info("Initial evaluation of miner hash rate")
 
 	oprHash := make([]byte, 32)
 	rand.Read(oprHash)
 
-	cli.miner.Mine(oprHash, []byte{19, 89}, math.MaxUint64)
-	timer := time.NewTimer(time.Minute)
-	<-timer.C
-
-	ms := cli.miner.Stop()
+	// A client failing to mine connects without a first estimation
+	ctx, cancel := context.WithTimeout(context.Background(), warmUpDuration)
+	defer cancel()
+	var warmingUp []*Client
+	for _, cli := range clients {
+		if err := cli.miner.Mine(ctx, oprHash, []byte{19, 89}, math.MaxUint64); err != nil {
+			cli.logger.WithError(err).Error("Failed to evaluate hash rate")
+			continue
+		}
+		warmingUp = append(warmingUp, cli)
+	}
+	<-ctx.Done()
 
-	err := common.SaveIndicativeHashRate(cli.miner.SubMinerCount, ms.TotalOps, ms.Duration)
-	if err != nil {
-		log.WithError(err).Fatal("Failed to save indicative hash rate")
+	for _, cli := range warmingUp {
+		if _, err := cli.miner.Stop(); err != nil {
+			cli.logger.WithError(err).Error("Failed to evaluate hash rate")
+			continue
+		}
+		cli.logger.Infof("Hash rate initially evaluated at %dh/s", cli.miner.HashRate())
 	}
-	log.Infof("Hash rate initially evaluated at %dh/s", common.GetIndicativeHashRate(cli.miner.SubMinerCount))
 }
@@ -0,0 +1,201 @@
+package orax
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	flatbuffers "github.com/google/flatbuffers/go"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/oraxpool/orax-cli/hash"
+	"gitlab.com/oraxpool/orax-cli/mining"
+	"gitlab.com/oraxpool/orax-cli/protocol"
+	"gitlab.com/oraxpool/orax-cli/trace"
+	"gitlab.com/oraxpool/orax-message/msg"
+)
+
+func TestMain(m *testing.M) {
+	hash.InitTestLXR()
+	os.Exit(m.Run())
+}
+
+// receivedMessages records the types of the messages of the client
+type receivedMessages struct {
+	mux   sync.Mutex
+	types []string
+}
+
+func (r *receivedMessages) add(msgType string) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.types = append(r.types, msgType)
+}
+
+func (r *receivedMessages) contains(msgType string) bool {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	for _, t := range r.types {
+		if t == msgType {
+			return true
+		}
+	}
+	return false
+}
+
+// fakeOrchestrator accepts the connections of the client with the
+// features and hands them to the test with the messages of the client
+// received on each, a share is found every 1024 hashes
+func fakeOrchestrator(features string) (*httptest.Server, string, <-chan *websocket.Conn, <-chan *receivedMessages) {
+	conns := make(chan *websocket.Conn, 1)
+	received := make(chan *receivedMessages, 1)
+	var upgrader websocket.Upgrader
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := http.Header{
+			"NoncePrefix":       []string{"ab"},
+			"Target":            []string{"18428729675200069632"},
+			"BatchingDuration":  []string{"3600"},
+			"InitialBatchDelay": []string{"3600"},
+			"Protocol-Features": []string{features},
+		}
+		conn, err := upgrader.Upgrade(w, r, header)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		messages := new(receivedMessages)
+		conns <- conn
+		received <- messages
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			msgType, _ := trace.Decode(data)
+			messages.add(msgType)
+		}
+	}))
+	return server, "ws" + strings.TrimPrefix(server.URL, "http"), conns, received
+}
+
+func startTestClient(endpoint string, stop <-chan struct{}) (*Client, <-chan struct{}) {
+	cli := new(Client)
+	done := cli.Start(ClientConfig{
+		Name:        "test",
+		MinerID:     "miner",
+		MinerSecret: "secret",
+		Endpoint:    endpoint,
+		NbMiners:    1,
+		SkipWarmUp:  true,
+	}, stop)
+	return cli, done
+}
+
+func startMining(t *testing.T, conn *websocket.Conn, miner *mining.SuperMiner) {
+	oprHash := make([]byte, 32)
+	require.NoError(t, conn.WriteMessage(websocket.BinaryMessage, msg.NewStartMiningMessage(flatbuffers.NewBuilder(1024), oprHash)))
+	waitFor(t, "mining session", miner.IsRunning)
+}
+
+func foundShares(miner *mining.SuperMiner) (shares int64) {
+	for _, stats := range miner.MinerStats() {
+		shares += stats.TotalShares
+	}
+	return shares
+}
+
+func waitFor(t *testing.T, what string, condition func() bool) {
+	for i := 0; i < 200; i++ {
+		if condition() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for the %s", what)
+}
+
+func TestControlMessages(t *testing.T) {
+	require := require.New(t)
+
+	server, endpoint, conns, received := fakeOrchestrator(protocol.FeatureControl)
+	defer server.Close()
+	redirected, redirectedEndpoint, redirectedConns, redirectedReceived := fakeOrchestrator(protocol.FeatureControl)
+	defer redirected.Close()
+
+	stop := make(chan struct{})
+	defer close(stop)
+	cli, done := startTestClient(endpoint, stop)
+	conn := <-conns
+	messages := <-received
+	startMining(t, conn, cli.miner)
+
+	require.NoError(conn.WriteMessage(websocket.BinaryMessage, protocol.NewPauseMessage(protocol.PauseMessage{Reason: "Maintenance"})))
+	waitFor(t, "pause", cli.miner.IsPaused)
+	require.NoError(conn.WriteMessage(websocket.BinaryMessage, protocol.NewResumeMessage()))
+	waitFor(t, "resume", func() bool { return !cli.miner.IsPaused() })
+
+	// A paused client stays paused in the next session
+	require.NoError(conn.WriteMessage(websocket.BinaryMessage, protocol.NewPauseMessage(protocol.PauseMessage{Duration: 3600})))
+	waitFor(t, "pause", cli.miner.IsPaused)
+	startMining(t, conn, cli.miner)
+	waitFor(t, "pause of the next session", cli.miner.IsPaused)
+	require.NoError(conn.WriteMessage(websocket.BinaryMessage, protocol.NewResumeMessage()))
+	waitFor(t, "resume", func() bool { return !cli.miner.IsPaused() })
+
+	// The running session ends with the connection, its shares submitted on it
+	waitFor(t, "shares", func() bool { return foundShares(cli.miner) > 0 })
+	require.False(messages.contains("Submit"))
+	require.NoError(conn.WriteMessage(websocket.BinaryMessage, protocol.NewReconnectMessage(protocol.ReconnectMessage{Endpoint: redirectedEndpoint})))
+	select {
+	case conn = <-redirectedConns:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the reconnection")
+	}
+	require.False(cli.miner.IsRunning())
+	require.True(messages.contains("Submit"))
+	messages = <-redirectedReceived
+
+	startMining(t, conn, cli.miner)
+	require.False(messages.contains("Submit"))
+	require.NoError(conn.WriteMessage(websocket.BinaryMessage, protocol.NewShutdownMessage(protocol.ShutdownMessage{Reason: "Retired"})))
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the client to stop")
+	}
+	require.False(cli.miner.IsRunning())
+}
+
+func TestControlMessagesNotEnabled(t *testing.T) {
+	require := require.New(t)
+
+	server, endpoint, conns, _ := fakeOrchestrator(protocol.FeatureSubmitAck)
+	defer server.Close()
+
+	stop := make(chan struct{})
+	cli, done := startTestClient(endpoint, stop)
+	conn := <-conns
+	startMining(t, conn, cli.miner)
+
+	require.NoError(conn.WriteMessage(websocket.BinaryMessage, protocol.NewPauseMessage(protocol.PauseMessage{})))
+	require.NoError(conn.WriteMessage(websocket.BinaryMessage, protocol.NewReconnectMessage(protocol.ReconnectMessage{})))
+	require.NoError(conn.WriteMessage(websocket.BinaryMessage, protocol.NewShutdownMessage(protocol.ShutdownMessage{})))
+	time.Sleep(200 * time.Millisecond)
+
+	select {
+	case <-done:
+		t.Fatal("The client stopped on a control message")
+	case <-conns:
+		t.Fatal("The client reconnected on a control message")
+	default:
+	}
+	require.True(cli.miner.IsRunning())
+	require.False(cli.miner.IsPaused())
+
+	close(stop)
+	<-done
+}
@@ -0,0 +1,181 @@
+package orax
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ScheduleConfig is the `schedule` section of the config file
+type ScheduleConfig struct {
+	Timezone string         `mapstructure:"timezone"`
+	Windows  []WindowConfig `mapstructure:"windows"`
+}
+
+type WindowConfig struct {
+	Days  []string `mapstructure:"days"`
+	Start string   `mapstructure:"start"`
+	End   string   `mapstructure:"end"`
+}
+
+// Schedule defines the time windows during which mining is allowed
+type Schedule struct {
+	Location *time.Location
+	Windows  []Window
+}
+
+// Window is a daily time range starting on the given week days.
+// A window ending before it starts spans over midnight.
+type Window struct {
+	Days [7]bool
+	// Minutes since midnight
+	Start int
+	End   int
+}
+
+type ScheduleTransition struct {
+	Time    time.Time
+	Allowed bool
+}
+
+var weekDays = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+// ParseSchedule validates the schedule config. It returns a nil
+// schedule (mining always allowed) if no window is configured.
+func ParseSchedule(config ScheduleConfig) (*Schedule, error) {
+	if len(config.Windows) == 0 {
+		return nil, nil
+	}
+
+	schedule := new(Schedule)
+	location, err := time.LoadLocation(config.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid schedule timezone: %s", err)
+	}
+	schedule.Location = location
+
+	for i, wc := range config.Windows {
+		var w Window
+		if len(wc.Days) == 0 {
+			for d := range w.Days {
+				w.Days[d] = true
+			}
+		}
+		for _, day := range wc.Days {
+			d, ok := weekDays[strings.ToLower(day)]
+			if !ok {
+				return nil, fmt.Errorf("Invalid day [%s] in schedule window %d", day, i+1)
+			}
+			w.Days[d] = true
+		}
+
+		w.Start, err = parseTimeOfDay(wc.Start)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid start of schedule window %d: %s", i+1, err)
+		}
+		w.End, err = parseTimeOfDay(wc.End)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid end of schedule window %d: %s", i+1, err)
+		}
+		schedule.Windows = append(schedule.Windows, w)
+	}
+
+	return schedule, nil
+}
+
+// parseTimeOfDay parses a HH:MM time into minutes since midnight
+func parseTimeOfDay(s string) (int, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("[%s] is not in HH:MM format", s)
+	}
+	h, err := strconv.Atoi(parts[0])
+	if err != nil || h < 0 || h > 24 {
+		return 0, fmt.Errorf("Invalid hour in [%s]", s)
+	}
+	m, err := strconv.Atoi(parts[1])
+	if err != nil || m < 0 || m > 59 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("Invalid minute in [%s]", s)
+	}
+	return h*60 + m, nil
+}
+
+// Allowed returns true if mining is allowed at the given time
+func (s *Schedule) Allowed(t time.Time) bool {
+	if s == nil {
+		return true
+	}
+	t = t.In(s.Location)
+	// A window started the day before may still be open
+	for _, day := range []time.Time{t.AddDate(0, 0, -1), t} {
+		for _, w := range s.Windows {
+			start, end, ok := w.on(day, s.Location)
+			if ok && !t.Before(start) && t.Before(end) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// on returns the occurrence of the window on the day of t
+func (w Window) on(t time.Time, location *time.Location) (start time.Time, end time.Time, ok bool) {
+	if !w.Days[t.Weekday()] {
+		return start, end, false
+	}
+	y, m, d := t.Date()
+	start = time.Date(y, m, d, 0, w.Start, 0, 0, location)
+	if w.End > w.Start {
+		end = time.Date(y, m, d, 0, w.End, 0, 0, location)
+	} else {
+		end = time.Date(y, m, d+1, 0, w.End, 0, 0, location)
+	}
+	return start, end, true
+}
+
+// NextTransitions returns up to n upcoming changes of the mining
+// allowance after t, looking at most a week ahead.
+func (s *Schedule) NextTransitions(t time.Time, n int) []ScheduleTransition {
+	if s == nil {
+		return nil
+	}
+	t = t.In(s.Location)
+
+	// Window boundaries are the only instants at which the allowance can change
+	var boundaries []time.Time
+	for i := -1; i <= 8; i++ {
+		day := t.AddDate(0, 0, i)
+		for _, w := range s.Windows {
+			if start, end, ok := w.on(day, s.Location); ok {
+				boundaries = append(boundaries, start, end)
+			}
+		}
+	}
+	sort.Slice(boundaries, func(i, j int) bool { return boundaries[i].Before(boundaries[j]) })
+
+	var transitions []ScheduleTransition
+	allowed := s.Allowed(t)
+	for _, b := range boundaries {
+		if len(transitions) == n {
+			break
+		}
+		if !b.After(t) || b.After(t.AddDate(0, 0, 7)) {
+			continue
+		}
+		if s.Allowed(b) != allowed {
+			allowed = !allowed
+			transitions = append(transitions, ScheduleTransition{Time: b, Allowed: allowed})
+		}
+	}
+	return transitions
+}
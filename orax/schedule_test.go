@@ -0,0 +1,48 @@
+package orax
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchedule(t *testing.T) {
+	require := require.New(t)
+
+	schedule, err := ParseSchedule(ScheduleConfig{
+		Timezone: "UTC",
+		Windows: []WindowConfig{
+			{Days: []string{"mon", "tue", "wed", "thu", "fri"}, Start: "22:00", End: "06:00"},
+			{Days: []string{"Saturday"}, Start: "00:00", End: "24:00"},
+		},
+	})
+	require.NoError(err)
+
+	// Monday 2019-11-04
+	monday := time.Date(2019, 11, 4, 12, 0, 0, 0, time.UTC)
+	require.False(schedule.Allowed(monday))
+	require.True(schedule.Allowed(monday.Add(10 * time.Hour)))
+	require.True(schedule.Allowed(monday.Add(17 * time.Hour)))
+	require.False(schedule.Allowed(monday.Add(18 * time.Hour)))
+
+	transitions := schedule.NextTransitions(monday, 2)
+	require.Len(transitions, 2)
+	require.Equal(time.Date(2019, 11, 4, 22, 0, 0, 0, time.UTC), transitions[0].Time)
+	require.True(transitions[0].Allowed)
+	require.Equal(time.Date(2019, 11, 5, 6, 0, 0, 0, time.UTC), transitions[1].Time)
+	require.False(transitions[1].Allowed)
+
+	// Friday night window runs into Saturday, which runs into Sunday
+	friday := time.Date(2019, 11, 8, 12, 0, 0, 0, time.UTC)
+	transitions = schedule.NextTransitions(friday, 2)
+	require.Len(transitions, 2)
+	require.Equal(time.Date(2019, 11, 8, 22, 0, 0, 0, time.UTC), transitions[0].Time)
+	require.Equal(time.Date(2019, 11, 10, 0, 0, 0, 0, time.UTC), transitions[1].Time)
+
+	_, err = ParseSchedule(ScheduleConfig{Windows: []WindowConfig{{Start: "25:00", End: "06:00"}}})
+	require.Error(err)
+
+	var none *Schedule
+	require.True(none.Allowed(monday))
+}
@@ -0,0 +1,211 @@
+package orax
+
+import (
+	"fmt"
+	"time"
+
+	flatbuffers "github.com/google/flatbuffers/go"
+	"github.com/sirupsen/logrus"
+
+	"gitlab.com/oraxpool/orax-cli/history"
+	"gitlab.com/oraxpool/orax-cli/mining"
+	"gitlab.com/oraxpool/orax-cli/protocol"
+	"gitlab.com/oraxpool/orax-message/msg"
+)
+
+// shareStats are the submission stats of a mining session
+type shareStats struct {
+	sent         int64
+	sendFailures int64
+	accepted     int64
+	rejected     int64
+	stale        int64
+	// Submit messages waiting for their acknowledgment
+	pending int
+}
+
+// queuedSubmit is a submit message waiting in the Send queue of the
+// websocket client, which survives the reconnections
+type queuedSubmit struct {
+	nonces int64
+	stats  *shareStats
+}
+
+// pendingSubmit is a submit message waiting for its acknowledgment
+type pendingSubmit struct {
+	nonces int64
+	sentAt time.Time
+	stats  *shareStats
+}
+
+// endedSession is a mining session recorded once
+// all its submit messages are acknowledged
+type endedSession struct {
+	session history.Session
+	stats   *shareStats
+}
+
+// startShareAccounting opens the stats of a new mining session
+func (cli *Client) startShareAccounting() {
+	cli.sharesMux.Lock()
+	defer cli.sharesMux.Unlock()
+	cli.shares = new(shareStats)
+}
+
+// setAcknowledging sets whether the orchestrator of the connection acknowledges the submits
+func (cli *Client) setAcknowledging(acknowledging bool) {
+	cli.sharesMux.Lock()
+	defer cli.sharesMux.Unlock()
+	cli.acknowledging = acknowledging
+}
+
+// sendShares queues a submit message without blocking and
+// returns false if the shares had to be dropped
+func (cli *Client) sendShares(nonces [][]byte) bool {
+	data := msg.NewSubmitMessage(flatbuffers.NewBuilder(1024), nonces)
+
+	cli.sharesMux.Lock()
+	defer cli.sharesMux.Unlock()
+
+	select {
+	case cli.wscli.Send <- data:
+		cli.queuedSubmits = append(cli.queuedSubmits, queuedSubmit{nonces: int64(len(nonces)), stats: cli.shares})
+		cli.shares.pending++
+		return true
+	default:
+		cli.shares.sendFailures++
+		return false
+	}
+}
+
+// submitWritten numbers the oldest queued submit once the websocket client
+// wrote it, the orchestrator numbering the submits of each connection from 1
+func (cli *Client) submitWritten(seq int64, err error) {
+	cli.sharesMux.Lock()
+	defer cli.sharesMux.Unlock()
+
+	if len(cli.queuedSubmits) == 0 {
+		return
+	}
+	submit := cli.queuedSubmits[0]
+	cli.queuedSubmits = cli.queuedSubmits[1:]
+
+	if err != nil {
+		submit.stats.sendFailures++
+		submit.stats.pending--
+		cli.recordEndedSessions(false)
+		return
+	}
+	// The acknowledgments of the previous connection won't come
+	if seq == 1 {
+		cli.pendingSubmits = make(map[int64]pendingSubmit)
+	}
+	submit.stats.sent += submit.nonces
+	cli.pendingSubmits[seq] = pendingSubmit{nonces: submit.nonces, sentAt: time.Now(), stats: submit.stats}
+}
+
+// handleSubmitAck accounts the shares acknowledged by the orchestrator
+// in the session they were submitted in
+func (cli *Client) handleSubmitAck(ack *protocol.SubmitAckMessage) {
+	cli.sharesMux.Lock()
+	defer cli.sharesMux.Unlock()
+
+	submit, ok := cli.pendingSubmits[ack.Seq]
+	if !ok {
+		cli.logger.WithField("seq", ack.Seq).Warn("Received the acknowledgment of an unknown submit")
+		return
+	}
+	delete(cli.pendingSubmits, ack.Seq)
+
+	submit.stats.pending--
+	submit.stats.accepted += ack.Accepted
+	submit.stats.rejected += ack.Rejected
+	submit.stats.stale += ack.Stale
+
+	ackLog := cli.logger.WithFields(logrus.Fields{
+		"seq":      ack.Seq,
+		"shares":   submit.nonces,
+		"accepted": ack.Accepted,
+		"rejected": ack.Rejected,
+		"stale":    ack.Stale,
+		"latency":  time.Since(submit.sentAt).Round(time.Millisecond),
+	})
+	if ack.Rejected > 0 {
+		ackLog.WithField("reason", ack.Reason).Warn("Shares rejected by the orchestrator")
+	} else {
+		ackLog.Debug("Shares acknowledged")
+	}
+
+	cli.recordEndedSessions(false)
+}
+
+// endMiningSession records the session in the history once its
+// submits are acknowledged
+func (cli *Client) endMiningSession(ms *mining.MiningSession) {
+	cli.sharesMux.Lock()
+	defer cli.sharesMux.Unlock()
+
+	cli.endedSessions = append(cli.endedSessions, endedSession{
+		session: history.Session{
+			MinerID:               cli.wscli.MinerID,
+			StartTime:             ms.StartTime,
+			EndTime:               ms.EndTime,
+			PausedDuration:        ms.PausedDuration,
+			ThrottledIdleDuration: ms.ThrottledIdleDuration,
+			OprHash:               fmt.Sprintf("%x", ms.OprHash),
+			Target:                ms.Target,
+			TotalOps:              ms.TotalOps,
+			BestDifficulty:        ms.BestDifficulty,
+			SharesFound:           ms.TotalShares,
+		},
+		stats: cli.shares,
+	})
+	cli.recordEndedSessions(false)
+}
+
+// flushEndedSessions records the ended sessions without
+// waiting any longer for their acknowledgments
+func (cli *Client) flushEndedSessions() {
+	cli.sharesMux.Lock()
+	defer cli.sharesMux.Unlock()
+	cli.recordEndedSessions(true)
+}
+
+// recordEndedSessions appends the acknowledged sessions to the local
+// history journal, all of them if force is set. sharesMux must be held.
+func (cli *Client) recordEndedSessions(force bool) {
+	for len(cli.endedSessions) > 0 {
+		ended := cli.endedSessions[0]
+		stats := ended.stats
+		// Unless the orchestrator doesn't acknowledge submits
+		if stats.pending > 0 && !force && cli.acknowledging {
+			return
+		}
+		cli.endedSessions = cli.endedSessions[1:]
+
+		session := ended.session
+		session.SharesSent = stats.sent
+		session.SendFailures = stats.sendFailures
+		session.SharesAccepted = stats.accepted
+		session.SharesRejected = stats.rejected
+		session.SharesStale = stats.stale
+
+		if cli.acknowledging {
+			sessionLog := cli.logger.WithFields(logrus.Fields{
+				"sent":     stats.sent,
+				"accepted": stats.accepted,
+				"rejected": stats.rejected,
+				"stale":    stats.stale,
+			})
+			if stats.pending > 0 {
+				sessionLog.WithField("unacknowledged", stats.pending).Warn("Some submits of the session were not acknowledged")
+			} else {
+				sessionLog.Info("All the submits of the session were acknowledged")
+			}
+		}
+
+		if err := history.Append(session); err != nil {
+			cli.logger.WithError(err).Warn("Failed to record mining session in history")
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package orax
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/oraxpool/orax-cli/mining"
+	"gitlab.com/oraxpool/orax-cli/protocol"
+	"gitlab.com/oraxpool/orax-cli/ws"
+)
+
+func TestShareAccounting(t *testing.T) {
+	require := require.New(t)
+
+	cli := &Client{logger: logrus.NewEntry(log), wscli: &ws.Client{Send: make(chan []byte, 2)}}
+	cli.setAcknowledging(true)
+	cli.startShareAccounting()
+
+	require.True(cli.sendShares([][]byte{{1}, {2}, {3}}))
+	require.True(cli.sendShares([][]byte{{4}}))
+	// The Send channel is full
+	require.False(cli.sendShares([][]byte{{5}}))
+	cli.submitWritten(1, nil)
+	cli.submitWritten(2, nil)
+
+	cli.handleSubmitAck(&protocol.SubmitAckMessage{Seq: 1, Accepted: 2, Rejected: 1, Reason: "Low difficulty"})
+	session := cli.shares
+	cli.endMiningSession(&mining.MiningSession{})
+
+	// The session waits for the acknowledgment of its last submit
+	cli.startShareAccounting()
+	require.Len(cli.endedSessions, 1)
+	cli.handleSubmitAck(&protocol.SubmitAckMessage{Seq: 2, Stale: 1})
+	require.Empty(cli.endedSessions)
+
+	require.Equal(shareStats{sent: 4, sendFailures: 1, accepted: 2, rejected: 1, stale: 1}, *session)
+
+	// Unknown acknowledgments are ignored
+	cli.handleSubmitAck(&protocol.SubmitAckMessage{Seq: 2, Accepted: 1})
+	require.Equal(int64(2), session.accepted)
+}
+
+func TestShareAccountingReconnection(t *testing.T) {
+	require := require.New(t)
+
+	cli := &Client{logger: logrus.NewEntry(log), wscli: &ws.Client{Send: make(chan []byte, 2)}}
+	cli.setAcknowledging(true)
+	cli.startShareAccounting()
+
+	require.True(cli.sendShares([][]byte{{1}}))
+	require.True(cli.sendShares([][]byte{{2}, {3}}))
+	<-cli.wscli.Send
+	cli.submitWritten(1, nil)
+	// The connection is lost while writing the second submit
+	<-cli.wscli.Send
+	cli.submitWritten(0, errors.New("broken pipe"))
+	require.Equal(shareStats{sent: 1, sendFailures: 1, pending: 1}, *cli.shares)
+
+	// Submits queued before the reconnection are numbered on the new connection
+	require.True(cli.sendShares([][]byte{{4}}))
+	cli.submitWritten(1, nil)
+	cli.handleSubmitAck(&protocol.SubmitAckMessage{Seq: 1, Accepted: 1})
+	// The acknowledgment of the first submit was lost with the connection
+	require.Equal(shareStats{sent: 2, sendFailures: 1, accepted: 1, pending: 1}, *cli.shares)
+}
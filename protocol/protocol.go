@@ -0,0 +1,157 @@
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+
+	"gitlab.com/oraxpool/orax-message/msg"
+)
+
+// Messages extending the set of orax-message, JSON encoded after their type
+const (
+	// SubmitAck reports how the orchestrator scored a submit message
+	SubmitAck msg.MessageType = msg.Submit + 1 + iota
+	// Control messages of the orchestrator
+	Pause
+	Resume
+	Reconnect
+	Shutdown
+)
+
+// SubmitAckMessage acknowledges the Seq-th submit message received
+// on the connection, starting at 1
+type SubmitAckMessage struct {
+	Seq      int64 `json:"seq"`
+	Accepted int64 `json:"accepted"`
+	Rejected int64 `json:"rejected"`
+	// Shares of a previous mining session
+	Stale  int64  `json:"stale"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// PauseMessage pauses mining while staying connected, for
+// Duration seconds if set or until a Resume message otherwise
+type PauseMessage struct {
+	Duration int64  `json:"duration,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+type ResumeMessage struct{}
+
+// ReconnectMessage asks to reconnect after Delay seconds, to
+// Endpoint if set or to the current endpoint otherwise
+type ReconnectMessage struct {
+	Endpoint string `json:"endpoint,omitempty"`
+	Delay    int64  `json:"delay,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// ShutdownMessage stops the miner
+type ShutdownMessage struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// UnmarshalMessage decodes the extension messages and
+// the ones of orax-message
+func UnmarshalMessage(bytes []byte) (interface{}, error) {
+	if len(bytes) <= 1 {
+		return nil, errors.New("Message too short")
+	}
+
+	var message interface{}
+	switch bytes[0] {
+	case SubmitAck:
+		message = new(SubmitAckMessage)
+	case Pause:
+		message = new(PauseMessage)
+	case Resume:
+		message = new(ResumeMessage)
+	case Reconnect:
+		message = new(ReconnectMessage)
+	case Shutdown:
+		message = new(ShutdownMessage)
+	default:
+		return msg.UnmarshalMessage(bytes)
+	}
+	if err := json.Unmarshal(bytes[1:], message); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// Marshal encodes an extension message of the given type
+func Marshal(msgType msg.MessageType, message interface{}) ([]byte, error) {
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{msgType}, payload...), nil
+}
+
+func NewSubmitAckMessage(ack SubmitAckMessage) []byte {
+	data, _ := Marshal(SubmitAck, ack)
+	return data
+}
+
+func NewPauseMessage(pause PauseMessage) []byte {
+	data, _ := Marshal(Pause, pause)
+	return data
+}
+
+func NewResumeMessage() []byte {
+	data, _ := Marshal(Resume, ResumeMessage{})
+	return data
+}
+
+func NewReconnectMessage(reconnect ReconnectMessage) []byte {
+	data, _ := Marshal(Reconnect, reconnect)
+	return data
+}
+
+func NewShutdownMessage(shutdown ShutdownMessage) []byte {
+	data, _ := Marshal(Shutdown, shutdown)
+	return data
+}
+
+// Features of the protocol negotiated in the handshake: the client
+// advertises the ones it supports, the orchestrator replies with the
+// ones it enables for the connection
+const (
+	// The orchestrator acknowledges each submit with a SubmitAck message
+	FeatureSubmitAck = "submit-ack"
+	// The orchestrator may send Pause, Resume, Reconnect and Shutdown messages
+	FeatureControl = "control"
+)
+
+var (
+	// Features supported by the client
+	Features = []string{FeatureSubmitAck, FeatureControl}
+	// Message types understood by the client
+	MessageTypes = []msg.MessageType{msg.StartMining, msg.SubmissionWindowClosing, msg.SetTarget, SubmitAck, Pause, Resume, Reconnect, Shutdown}
+)
+
+// FormatMessageTypes returns the message types as a header value
+func FormatMessageTypes(types []msg.MessageType) string {
+	formatted := make([]string, len(types))
+	for i, t := range types {
+		formatted[i] = strconv.Itoa(int(t))
+	}
+	return strings.Join(formatted, ",")
+}
+
+// ParseFeatures returns the features of a header value
+// supported by the client
+func ParseFeatures(value string) map[string]bool {
+	enabled := make(map[string]bool)
+	for _, feature := range strings.Split(value, ",") {
+		feature = strings.ToLower(strings.TrimSpace(feature))
+		for _, supported := range Features {
+			if feature == supported {
+				enabled[feature] = true
+			}
+		}
+	}
+	return enabled
+}
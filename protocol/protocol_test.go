@@ -0,0 +1,35 @@
+package protocol
+
+import (
+	"testing"
+
+	flatbuffers "github.com/google/flatbuffers/go"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/oraxpool/orax-message/msg"
+	"gitlab.com/oraxpool/orax-message/msg/fbs"
+)
+
+func TestUnmarshalMessage(t *testing.T) {
+	require := require.New(t)
+
+	ack := SubmitAckMessage{Seq: 3, Accepted: 10, Rejected: 1, Reason: "Duplicate"}
+	message, err := UnmarshalMessage(NewSubmitAckMessage(ack))
+	require.NoError(err)
+	require.Equal(&ack, message)
+
+	// Messages of orax-message are still decoded
+	message, err = UnmarshalMessage(msg.NewSetTargetMessage(flatbuffers.NewBuilder(1024), 42))
+	require.NoError(err)
+	require.Equal(uint64(42), message.(*fbs.SetTargetMessage).Target())
+
+	_, err = UnmarshalMessage([]byte{SubmitAck, '{'})
+	require.Error(err)
+}
+
+func TestParseFeatures(t *testing.T) {
+	require := require.New(t)
+
+	require.Equal(map[string]bool{FeatureSubmitAck: true, FeatureControl: true}, ParseFeatures("Submit-Ack, control,unknown"))
+	require.Empty(ParseFeatures(""))
+	require.Equal("3,4", FormatMessageTypes([]msg.MessageType{msg.StartMining, msg.SubmissionWindowClosing}))
+}
@@ -0,0 +1,130 @@
+package replay
+
+import (
+	"encoding/hex"
+
+	"gitlab.com/oraxpool/orax-cli/trace"
+)
+
+// WindowDiff compares the nonces submitted during the nth submit window
+// of the recording with the ones of the nth window of the replay.
+// The client submits its shares in batches on a timer, so the nonces
+// are compared by window rather than by message.
+type WindowDiff struct {
+	OprHash  string
+	Recorded []trace.Frame
+	Replayed []trace.Frame
+	// Nonces found in both, in the recorded window only and in the replayed one only
+	Common       int
+	OnlyRecorded int
+	OnlyReplayed int
+}
+
+// Difference is the share of the nonces of the window found in one session only
+func (d WindowDiff) Difference() float64 {
+	total := d.Common + d.OnlyRecorded + d.OnlyReplayed
+	if total == 0 {
+		return 0
+	}
+	return float64(d.OnlyRecorded+d.OnlyReplayed) / float64(total)
+}
+
+// Matches returns true if at most the tolerance of the
+// nonces of the window were found in one session only.
+// The number of hashes computed before the window closes depends on
+// the timing of the sub-miners, a tolerance of 0 requires the same nonces.
+func (d WindowDiff) Matches(tolerance float64) bool {
+	return d.Difference() <= tolerance
+}
+
+// Diff of the shares submitted by the client during the recording and the replay
+type Diff struct {
+	Windows []WindowDiff
+	// Nonces submitted over the whole session, regardless of the window
+	Common       int
+	OnlyRecorded int
+	OnlyReplayed int
+}
+
+func (d Diff) Matches(tolerance float64) bool {
+	for _, w := range d.Windows {
+		if !w.Matches(tolerance) {
+			return false
+		}
+	}
+	return true
+}
+
+// submitWindow gathers the submit messages following a StartMining message
+type submitWindow struct {
+	oprHash string
+	submits []trace.Frame
+}
+
+// Compare the submit messages sent by the client in both frame lists
+func Compare(recorded []trace.Frame, replayed []trace.Frame) Diff {
+	recordedWindows := windows(recorded)
+	replayedWindows := windows(replayed)
+
+	var diff Diff
+	var recordedSubmits, replayedSubmits []trace.Frame
+	for i := 0; i < len(recordedWindows) || i < len(replayedWindows); i++ {
+		var w WindowDiff
+		if i < len(recordedWindows) {
+			w.OprHash = recordedWindows[i].oprHash
+			w.Recorded = recordedWindows[i].submits
+		}
+		if i < len(replayedWindows) {
+			w.OprHash = replayedWindows[i].oprHash
+			w.Replayed = replayedWindows[i].submits
+		}
+		w.Common, w.OnlyRecorded, w.OnlyReplayed = compareNonces(allNonces(w.Recorded), allNonces(w.Replayed))
+		diff.Windows = append(diff.Windows, w)
+		recordedSubmits = append(recordedSubmits, w.Recorded...)
+		replayedSubmits = append(replayedSubmits, w.Replayed...)
+	}
+
+	diff.Common, diff.OnlyRecorded, diff.OnlyReplayed = compareNonces(allNonces(recordedSubmits), allNonces(replayedSubmits))
+	return diff
+}
+
+// windows splits the submit messages by the StartMining message they follow
+func windows(frames []trace.Frame) []submitWindow {
+	var windows []submitWindow
+	for _, frame := range frames {
+		msgType, fields := trace.Decode(frame.Raw)
+		switch {
+		case frame.Direction == trace.Inbound && msgType == "StartMining":
+			oprHash, _ := fields["oprHash"].(string)
+			windows = append(windows, submitWindow{oprHash: oprHash})
+		case frame.Direction == trace.Outbound && msgType == "Submit" && len(windows) > 0:
+			w := &windows[len(windows)-1]
+			w.submits = append(w.submits, frame)
+		}
+	}
+	return windows
+}
+
+func allNonces(frames []trace.Frame) [][]byte {
+	var nonces [][]byte
+	for _, frame := range frames {
+		nonces = append(nonces, trace.Nonces(frame.Raw)...)
+	}
+	return nonces
+}
+
+func compareNonces(recorded [][]byte, replayed [][]byte) (common int, onlyRecorded int, onlyReplayed int) {
+	set := make(map[string]bool, len(recorded))
+	for _, nonce := range recorded {
+		set[hex.EncodeToString(nonce)] = true
+	}
+	for _, nonce := range replayed {
+		if set[hex.EncodeToString(nonce)] {
+			common++
+			delete(set, hex.EncodeToString(nonce))
+		} else {
+			onlyReplayed++
+		}
+	}
+	return common, len(set), onlyReplayed
+}
@@ -0,0 +1,59 @@
+package replay
+
+import (
+	"strings"
+	"testing"
+
+	flatbuffers "github.com/google/flatbuffers/go"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/oraxpool/orax-cli/trace"
+	"gitlab.com/oraxpool/orax-message/msg"
+)
+
+func TestCompareWindows(t *testing.T) {
+	require := require.New(t)
+
+	startMining := func(b byte) trace.Frame {
+		oprHash := make([]byte, 32)
+		oprHash[0] = b
+		return trace.Frame{Direction: trace.Inbound, Raw: msg.NewStartMiningMessage(flatbuffers.NewBuilder(1024), oprHash)}
+	}
+	submit := func(nonces ...byte) trace.Frame {
+		var n [][]byte
+		for _, nonce := range nonces {
+			n = append(n, []byte{nonce})
+		}
+		return trace.Frame{Direction: trace.Outbound, Raw: msg.NewSubmitMessage(flatbuffers.NewBuilder(1024), n)}
+	}
+
+	recorded := []trace.Frame{
+		startMining(1), submit(1, 2), submit(3, 4, 5),
+		startMining(2), submit(6, 7, 8, 9, 10, 11, 12, 13, 14, 15),
+	}
+	// Same shares of the first window batched differently, one of
+	// the second window found before the window closed in one session only
+	replayed := []trace.Frame{
+		startMining(1), submit(1), submit(2, 3, 4, 5),
+		startMining(2), submit(6, 7, 8, 9, 10, 11, 12, 13, 14),
+	}
+
+	diff := Compare(recorded, replayed)
+	require.Len(diff.Windows, 2)
+	require.Equal("01"+strings.Repeat("00", 31), diff.Windows[0].OprHash)
+	require.True(diff.Windows[0].Matches(0))
+	require.Len(diff.Windows[0].Recorded, 2)
+	require.Len(diff.Windows[0].Replayed, 2)
+	require.Equal(5, diff.Windows[0].Common)
+
+	require.Equal(9, diff.Windows[1].Common)
+	require.Equal(1, diff.Windows[1].OnlyRecorded)
+	require.InDelta(0.1, diff.Windows[1].Difference(), 1e-9)
+	require.False(diff.Matches(0))
+	require.True(diff.Matches(0.1))
+
+	// A window the replay never reached
+	diff = Compare(recorded, replayed[:3])
+	require.Len(diff.Windows, 2)
+	require.Equal(1.0, diff.Windows[1].Difference())
+	require.False(diff.Matches(0.5))
+}
@@ -0,0 +1,227 @@
+package replay
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"gitlab.com/oraxpool/orax-cli/common"
+	"gitlab.com/oraxpool/orax-cli/trace"
+)
+
+var log = common.GetLog()
+
+// Time left to the client to submit its last shares after the
+// final message of the trace, covering the random submission delay
+const settleDuration = 5 * time.Second
+
+var ErrNoConnection = errors.New("The trace doesn't contain any connection to replay")
+
+// connection is a recorded connection to the orchestrator
+type connection struct {
+	start   time.Time
+	end     time.Time
+	headers map[string]interface{}
+	frames  []trace.Frame
+}
+
+// Server is a fake orchestrator sending the recorded messages to the
+// client at their original pace, divided by Speed. The connections of
+// the trace are replayed in order and the messages exchanged with the
+// client are collected.
+type Server struct {
+	URL   string
+	Speed float64
+	// Time left to the client to submit after the last message
+	Settle time.Duration
+
+	connections []connection
+	listener    net.Listener
+	upgrader    websocket.Upgrader
+
+	mux      sync.Mutex
+	next     int
+	replayed []trace.Frame
+	done     chan struct{}
+}
+
+// Miners returns the names of the miners of the trace
+func Miners(frames []trace.Frame) []string {
+	names := make(map[string]bool)
+	for _, frame := range frames {
+		names[frame.Miner] = true
+	}
+	var sorted []string
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// Select returns the frames of the miner. The miner can be omitted
+// if the trace was recorded with a single one.
+func Select(frames []trace.Frame, miner string) ([]trace.Frame, error) {
+	if miners := Miners(frames); miner == "" && len(miners) > 1 {
+		return nil, fmt.Errorf("The trace contains several miners, select one of: %s", strings.Join(miners, ", "))
+	}
+
+	var selected []trace.Frame
+	for _, frame := range frames {
+		if miner == "" || frame.Miner == miner {
+			selected = append(selected, frame)
+		}
+	}
+	return selected, nil
+}
+
+// NewServer starts a fake orchestrator on a local port
+// replaying the frames of a single miner
+func NewServer(frames []trace.Frame, speed float64) (*Server, error) {
+	s := &Server{Speed: speed, Settle: settleDuration, done: make(chan struct{})}
+	for _, frame := range frames {
+		if frame.Direction == trace.Connect {
+			headers, _ := frame.Fields["headers"].(map[string]interface{})
+			s.connections = append(s.connections, connection{start: frame.Time, headers: headers})
+		}
+		if len(s.connections) == 0 {
+			continue
+		}
+		c := &s.connections[len(s.connections)-1]
+		c.end = frame.Time
+		if frame.Direction == trace.Inbound {
+			c.frames = append(c.frames, frame)
+		}
+	}
+	if len(s.connections) == 0 {
+		return nil, ErrNoConnection
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s.listener = listener
+	s.URL = "ws://" + listener.Addr().String() + "/miner"
+	go http.Serve(listener, http.HandlerFunc(s.serve))
+
+	return s, nil
+}
+
+// Done is closed once the last connection was replayed
+func (s *Server) Done() <-chan struct{} {
+	return s.done
+}
+
+// Replayed returns the messages exchanged with the client,
+// following the Connect event of each connection
+func (s *Server) Replayed() []trace.Frame {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return append([]trace.Frame(nil), s.replayed...)
+}
+
+func (s *Server) record(frame trace.Frame) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.replayed = append(s.replayed, frame)
+}
+
+func (s *Server) Close() error {
+	return s.listener.Close()
+}
+
+// wait returns false if the client disconnected before the
+// recorded time elapsed since the start of the connection
+func (s *Server) wait(start time.Time, elapsed time.Duration, clientGone <-chan struct{}) bool {
+	timer := time.NewTimer(time.Until(start.Add(time.Duration(float64(elapsed) / s.Speed))))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-clientGone:
+		return false
+	}
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.mux.Lock()
+	if s.next >= len(s.connections) {
+		s.mux.Unlock()
+		http.Error(w, "Replay over", http.StatusServiceUnavailable)
+		return
+	}
+	c := s.connections[s.next]
+	s.next++
+	last := s.next == len(s.connections)
+	s.mux.Unlock()
+	if last {
+		defer close(s.done)
+	}
+
+	header := http.Header{}
+	for name, value := range c.headers {
+		header.Set(name, fmt.Sprint(value))
+	}
+	conn, err := s.upgrader.Upgrade(w, r, header)
+	if err != nil {
+		log.WithError(err).Error("Failed to accept replayed connection")
+		return
+	}
+	defer conn.Close()
+	start := time.Now()
+	s.record(trace.Frame{Time: start, Direction: trace.Connect})
+
+	clientGone := make(chan struct{})
+	go func() {
+		defer close(clientGone)
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			msgType, fields := trace.Decode(data)
+			s.record(trace.Frame{Time: time.Now(), Direction: trace.Outbound, Type: msgType, Fields: fields, Raw: data})
+		}
+	}()
+
+	for _, frame := range c.frames {
+		if !s.wait(start, frame.Time.Sub(c.start), clientGone) {
+			return
+		}
+		// Recorded before the write for the replies of the client to follow it
+		frame.Time = time.Now()
+		s.record(frame)
+		if err := conn.WriteMessage(websocket.BinaryMessage, frame.Raw); err != nil {
+			log.WithError(err).Error("Failed to replay message")
+			return
+		}
+	}
+	if !s.wait(start, c.end.Sub(c.start), clientGone) {
+		return
+	}
+
+	// Drop the connection for the client to reconnect
+	// to the next one, or close the last one gracefully
+	if !last {
+		return
+	}
+	select {
+	case <-time.After(s.Settle):
+	case <-clientGone:
+		return
+	}
+	conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, "Replay over"),
+		time.Now().Add(time.Second))
+	select {
+	case <-clientGone:
+	case <-time.After(2 * time.Second):
+	}
+}
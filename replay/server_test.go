@@ -0,0 +1,70 @@
+package replay
+
+import (
+	"testing"
+	"time"
+
+	flatbuffers "github.com/google/flatbuffers/go"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/oraxpool/orax-cli/trace"
+	"gitlab.com/oraxpool/orax-message/msg"
+)
+
+func TestServer(t *testing.T) {
+	require := require.New(t)
+
+	start := time.Now().Add(-time.Hour)
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+	nonces := [][]byte{{1, 2}, {3, 4}}
+	frames := []trace.Frame{
+		{Time: at(0), Direction: trace.Connect, Fields: map[string]interface{}{"headers": map[string]interface{}{"Target": "42"}}},
+		{Time: at(100), Direction: trace.Inbound, Raw: msg.NewStartMiningMessage(flatbuffers.NewBuilder(1024), make([]byte, 32))},
+		{Time: at(400), Direction: trace.Inbound, Raw: msg.NewSubmissionWindowClosingMessage(flatbuffers.NewBuilder(1024), 1)},
+		{Time: at(500), Direction: trace.Outbound, Type: "Submit", Raw: msg.NewSubmitMessage(flatbuffers.NewBuilder(1024), nonces)},
+		{Time: at(600), Direction: trace.Disconnect},
+	}
+
+	server, err := NewServer(frames, 4)
+	require.NoError(err)
+	defer server.Close()
+	server.Settle = 10 * time.Millisecond
+
+	began := time.Now()
+	conn, resp, err := websocket.DefaultDialer.Dial(server.URL, nil)
+	require.NoError(err)
+	defer conn.Close()
+	require.Equal("42", resp.Header.Get("Target"))
+
+	// Messages are sent at 4 times the recorded pace
+	_, data, err := conn.ReadMessage()
+	require.NoError(err)
+	require.Equal(frames[1].Raw, data)
+	_, data, err = conn.ReadMessage()
+	require.NoError(err)
+	require.Equal(frames[2].Raw, data)
+	require.InDelta(100*time.Millisecond, time.Since(began), float64(50*time.Millisecond))
+
+	require.NoError(conn.WriteMessage(websocket.BinaryMessage, msg.NewSubmitMessage(flatbuffers.NewBuilder(1024), nonces[:1])))
+
+	// The last connection is closed gracefully
+	_, _, err = conn.ReadMessage()
+	require.True(websocket.IsCloseError(err, websocket.CloseNormalClosure))
+	<-server.Done()
+
+	replayed := server.Replayed()
+	require.Len(replayed, 4)
+	require.Equal(trace.Connect, replayed[0].Direction)
+	require.Equal(trace.Inbound, replayed[1].Direction)
+	require.Equal(frames[1].Raw, replayed[1].Raw)
+	require.Equal("Submit", replayed[3].Type)
+
+	diff := Compare(frames, replayed)
+	require.False(diff.Matches(0))
+	require.Len(diff.Windows, 1)
+	require.Equal(1, diff.Common)
+	require.Equal(1, diff.OnlyRecorded)
+	require.Equal(0, diff.OnlyReplayed)
+
+	require.True(Compare(frames, frames).Matches(0))
+}
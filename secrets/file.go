@@ -0,0 +1,196 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// scrypt parameters recommended for interactive logins
+const (
+	scryptN   = 1 << 15
+	scryptR   = 8
+	scryptP   = 1
+	keyLength = 32
+)
+
+// fileContent is the JSON layout of the secrets file
+type fileContent struct {
+	Salt  []byte `json:"salt"`
+	Nonce []byte `json:"nonce"`
+	Data  []byte `json:"data"`
+}
+
+// FileStore keeps the secrets in a file encrypted with AES-GCM
+// using a key derived from a passphrase with scrypt
+type FileStore struct {
+	path       string
+	passphrase func() (string, error)
+
+	mux     sync.Mutex
+	loaded  bool
+	salt    []byte
+	key     []byte
+	secrets map[string]string
+}
+
+// NewFileStore returns a store backed by the file at path. The passphrase
+// is only requested when the secrets are first accessed.
+func NewFileStore(path string, passphrase func() (string, error)) *FileStore {
+	return &FileStore{path: path, passphrase: passphrase}
+}
+
+func (fs *FileStore) Get(key string) (string, error) {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+
+	if err := fs.load(); err != nil {
+		return "", err
+	}
+	return fs.secrets[key], nil
+}
+
+func (fs *FileStore) Set(key string, value string) error {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+
+	if err := fs.load(); err != nil {
+		return err
+	}
+	fs.secrets[key] = value
+	return fs.save()
+}
+
+func (fs *FileStore) Delete(key string) error {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+
+	if err := fs.load(); err != nil {
+		return err
+	}
+	if _, ok := fs.secrets[key]; !ok {
+		return nil
+	}
+	delete(fs.secrets, key)
+	return fs.save()
+}
+
+func (fs *FileStore) Keys() ([]string, error) {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+
+	if err := fs.load(); err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(fs.secrets))
+	for key := range fs.secrets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (fs *FileStore) load() error {
+	if fs.loaded {
+		return nil
+	}
+
+	passphrase, err := fs.passphrase()
+	if err != nil {
+		return err
+	}
+
+	raw, err := ioutil.ReadFile(fs.path)
+	if os.IsNotExist(err) {
+		// First use, the file is created by the first Set
+		fs.salt = make([]byte, 16)
+		if _, err := rand.Read(fs.salt); err != nil {
+			return err
+		}
+		if fs.key, err = deriveKey(passphrase, fs.salt); err != nil {
+			return err
+		}
+		fs.secrets = make(map[string]string)
+		fs.loaded = true
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var content fileContent
+	if err := json.Unmarshal(raw, &content); err != nil {
+		return err
+	}
+	key, err := deriveKey(passphrase, content.Salt)
+	if err != nil {
+		return err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+	plaintext, err := gcm.Open(nil, content.Nonce, content.Data, nil)
+	if err != nil {
+		return ErrWrongPassphrase
+	}
+
+	secrets := make(map[string]string)
+	if err := json.Unmarshal(plaintext, &secrets); err != nil {
+		return err
+	}
+	fs.salt = content.Salt
+	fs.key = key
+	fs.secrets = secrets
+	fs.loaded = true
+	return nil
+}
+
+func (fs *FileStore) save() error {
+	plaintext, err := json.Marshal(fs.secrets)
+	if err != nil {
+		return err
+	}
+	gcm, err := newGCM(fs.key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(fileContent{
+		Salt:  fs.salt,
+		Nonce: nonce,
+		Data:  gcm.Seal(nil, nonce, plaintext, nil),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Replace the file atomically to never lose the secrets
+	tmp := fs.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, raw, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, fs.path)
+}
+
+func deriveKey(passphrase string, salt []byte) ([]byte, error) {
+	return scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, keyLength)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
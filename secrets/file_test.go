@@ -0,0 +1,43 @@
+package secrets
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileStore(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "secrets")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "secrets.enc")
+
+	passphrase := func(p string) func() (string, error) {
+		return func() (string, error) { return p, nil }
+	}
+
+	store := NewFileStore(path, passphrase("correct horse"))
+	require.NoError(store.Set("miner_secret", "s3cr3t"))
+	require.NoError(store.Set("jwt", "token"))
+	require.NoError(store.Delete("jwt"))
+
+	raw, err := ioutil.ReadFile(path)
+	require.NoError(err)
+	require.NotContains(string(raw), "s3cr3t")
+
+	reopened := NewFileStore(path, passphrase("correct horse"))
+	value, err := reopened.Get("miner_secret")
+	require.NoError(err)
+	require.Equal("s3cr3t", value)
+	keys, err := reopened.Keys()
+	require.NoError(err)
+	require.Equal([]string{"miner_secret"}, keys)
+
+	_, err = NewFileStore(path, passphrase("wrong")).Get("miner_secret")
+	require.Equal(ErrWrongPassphrase, err)
+}
@@ -0,0 +1,80 @@
+package secrets
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// KeyringStore delegates the secrets to the Secret Service of the
+// desktop session (GNOME Keyring, KWallet) through secret-tool
+type KeyringStore struct {
+	service string
+}
+
+// NewKeyringStore returns ErrNoKeyring if secret-tool isn't installed
+func NewKeyringStore(service string) (*KeyringStore, error) {
+	if _, err := exec.LookPath("secret-tool"); err != nil {
+		return nil, ErrNoKeyring
+	}
+	return &KeyringStore{service: service}, nil
+}
+
+func (ks *KeyringStore) Get(key string) (string, error) {
+	out, err := exec.Command("secret-tool", "lookup", "service", ks.service, "key", key).Output()
+	if err != nil {
+		// secret-tool exits with 1 when the secret doesn't exist
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+			return "", nil
+		}
+		return "", err
+	}
+	return strings.TrimRight(string(out), "\r\n"), nil
+}
+
+func (ks *KeyringStore) Set(key string, value string) error {
+	cmd := exec.Command("secret-tool", "store", "--label", "orax-cli "+key, "service", ks.service, "key", key)
+	cmd.Stdin = strings.NewReader(value)
+	return run(cmd)
+}
+
+func (ks *KeyringStore) Delete(key string) error {
+	return run(exec.Command("secret-tool", "clear", "service", ks.service, "key", key))
+}
+
+func (ks *KeyringStore) Keys() ([]string, error) {
+	// Each item is listed with its attributes, as `attribute.key = miner_secret`
+	out, err := exec.Command("secret-tool", "search", "--all", "service", ks.service).CombinedOutput()
+	if err != nil {
+		// secret-tool exits with 1 when no secret matches
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 && len(bytes.TrimSpace(out)) == 0 {
+			return nil, nil
+		}
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return nil, errors.New(msg)
+		}
+		return nil, err
+	}
+	var keys []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if parts := strings.SplitN(line, "=", 2); len(parts) == 2 && strings.TrimSpace(parts[0]) == "attribute.key" {
+			keys = append(keys, strings.TrimSpace(parts[1]))
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func run(cmd *exec.Cmd) error {
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if stderr.Len() > 0 {
+			return errors.New(strings.TrimSpace(stderr.String()))
+		}
+		return err
+	}
+	return nil
+}
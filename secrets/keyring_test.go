@@ -0,0 +1,76 @@
+package secrets
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSecretTool puts on the PATH a secret-tool running the script
+func fakeSecretTool(t *testing.T, script string) func() {
+	if runtime.GOOS == "windows" {
+		t.Skip("secret-tool is only used on Linux")
+	}
+	dir, err := ioutil.TempDir("", "secret-tool")
+	require.NoError(t, err)
+	err = ioutil.WriteFile(filepath.Join(dir, "secret-tool"), []byte("#!/bin/sh\n"+script), 0700)
+	require.NoError(t, err)
+
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+	return func() {
+		os.Setenv("PATH", path)
+		os.RemoveAll(dir)
+	}
+}
+
+func TestKeyringGetTrimsNewline(t *testing.T) {
+	defer fakeSecretTool(t, `echo "s3cr3t"`)()
+
+	store, err := NewKeyringStore("orax-cli")
+	require.NoError(t, err)
+	value, err := store.Get("miner_secret")
+	require.NoError(t, err)
+	require.Equal(t, "s3cr3t", value)
+}
+
+func TestKeyringKeys(t *testing.T) {
+	defer fakeSecretTool(t, `
+echo "[/org/freedesktop/secrets/collection/login/1]"
+echo "label = orax-cli miner_secret"
+echo "attribute.service = orax-cli"
+echo "attribute.key = miner_secret"
+echo "[/org/freedesktop/secrets/collection/login/2]"
+echo "attribute.service = orax-cli"
+echo "attribute.key = jwt"
+`)()
+
+	store, err := NewKeyringStore("orax-cli")
+	require.NoError(t, err)
+	keys, err := store.Keys()
+	require.NoError(t, err)
+	require.Equal(t, []string{"jwt", "miner_secret"}, keys)
+}
+
+func TestKeyringKeysEmpty(t *testing.T) {
+	defer fakeSecretTool(t, `exit 1`)()
+
+	store, err := NewKeyringStore("orax-cli")
+	require.NoError(t, err)
+	keys, err := store.Keys()
+	require.NoError(t, err)
+	require.Empty(t, keys)
+}
+
+func TestKeyringKeysError(t *testing.T) {
+	defer fakeSecretTool(t, `echo "Cannot autolaunch D-Bus without X11 \$DISPLAY" >&2; exit 1`)()
+
+	store, err := NewKeyringStore("orax-cli")
+	require.NoError(t, err)
+	_, err = store.Keys()
+	require.EqualError(t, err, "Cannot autolaunch D-Bus without X11 $DISPLAY")
+}
@@ -0,0 +1,19 @@
+package secrets
+
+import (
+	"errors"
+)
+
+var (
+	ErrWrongPassphrase = errors.New("Wrong passphrase for the secrets file")
+	ErrNoKeyring       = errors.New("No keyring available, secret-tool (libsecret) is required")
+)
+
+// Store keeps secrets out of the plaintext config file
+type Store interface {
+	// Get returns an empty string if the secret isn't stored
+	Get(key string) (string, error)
+	Set(key string, value string) error
+	Delete(key string) error
+	Keys() ([]string, error)
+}
@@ -0,0 +1,12 @@
+//go:build !windows
+// +build !windows
+
+package state
+
+import "syscall"
+
+// writable checks the process can create files in the directory
+func writable(dir string) error {
+	const wOK = 2
+	return syscall.Access(dir, wOK)
+}
@@ -0,0 +1,6 @@
+package state
+
+// writable isn't checked on Windows, the permissions being ACLs
+func writable(dir string) error {
+	return nil
+}
@@ -0,0 +1,204 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	fileName = "state.json"
+
+	// Location of the state file when the config directory is read-only
+	PathEnv = "ORAX_STATE_FILE"
+)
+
+// State is the runtime state of orax-cli, kept apart from
+// the config file that belongs to the user
+type State struct {
+	HashRates HashRates                `json:"hashRates"`
+	Profiles  map[string]*ProfileState `json:"profiles"`
+}
+
+// HashRates is the history of hash rates measured on
+// the hardware matching the fingerprint
+type HashRates struct {
+	Fingerprint string                      `json:"fingerprint"`
+	History     map[string][]HashRateSample `json:"history"`
+}
+
+// HashRateSample is the hash rate measured during a mining session
+type HashRateSample struct {
+	Time     int64   `json:"time"`
+	HashRate int64   `json:"hashRate"`
+	Duration float64 `json:"duration"`
+}
+
+// ProfileState is the state specific to a profile
+type ProfileState struct {
+	UserID string `json:"userId,omitempty"`
+	JWT    string `json:"jwt,omitempty"`
+	// Endpoint the orchestrator redirected each miner to
+	LastEndpoints map[string]string `json:"lastEndpoints,omitempty"`
+}
+
+var (
+	mux     sync.Mutex
+	current *State
+
+	migrations []func(*State)
+)
+
+// RegisterMigration adds a function seeding a new state
+// with the values previously stored in the config file
+func RegisterMigration(migration func(*State)) {
+	migrations = append(migrations, migration)
+}
+
+// Path of the state file, stored next to the config file unless
+// ORAX_STATE_FILE is set. Empty when running without a config file.
+func Path() string {
+	if path := os.Getenv(PathEnv); path != "" {
+		return path
+	}
+	if viper.ConfigFileUsed() == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(viper.ConfigFileUsed()), fileName)
+}
+
+// Get returns a copy of the state
+func Get() State {
+	mux.Lock()
+	defer mux.Unlock()
+
+	load()
+	return current.copy()
+}
+
+// Update modifies the state and saves it. The state is updated in memory
+// even if it cannot be saved.
+func Update(update func(*State)) error {
+	mux.Lock()
+	defer mux.Unlock()
+
+	load()
+	update(current)
+	return save()
+}
+
+// Check verifies the state file can be read and saved, without
+// creating or migrating it. exists is false before the first run.
+func Check() (exists bool, err error) {
+	if Path() == "" {
+		return false, nil
+	}
+	raw, err := ioutil.ReadFile(Path())
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return false, err
+	default:
+		exists = true
+		if err := json.Unmarshal(raw, new(State)); err != nil {
+			return true, fmt.Errorf("Corrupted state file %s: %s", Path(), err)
+		}
+	}
+	// The state is saved with a temporary file renamed over the previous one
+	if err := writable(filepath.Dir(Path())); err != nil {
+		return exists, fmt.Errorf("Cannot save the state in %s: %s", filepath.Dir(Path()), err)
+	}
+	return exists, nil
+}
+
+// Profile returns the state of the profile, created if necessary
+func (s *State) Profile(name string) *ProfileState {
+	if s.Profiles[name] == nil {
+		s.Profiles[name] = &ProfileState{}
+	}
+	return s.Profiles[name]
+}
+
+func load() {
+	if current != nil {
+		return
+	}
+
+	current = new(State)
+	raw, err := ioutil.ReadFile(Path())
+	if err == nil {
+		err = json.Unmarshal(raw, current)
+	}
+	current.init()
+	if err == nil {
+		return
+	}
+
+	// First run with a state file, or a corrupted one
+	for _, migrate := range migrations {
+		migrate(current)
+	}
+	if os.IsNotExist(err) {
+		save()
+	}
+}
+
+// save replaces the state file atomically
+func save() error {
+	if Path() == "" {
+		return nil
+	}
+
+	raw, err := json.MarshalIndent(current, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := Path() + ".tmp"
+	if err := ioutil.WriteFile(tmp, raw, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, Path())
+}
+
+func (s *State) init() {
+	if s.HashRates.History == nil {
+		s.HashRates.History = make(map[string][]HashRateSample)
+	}
+	if s.Profiles == nil {
+		s.Profiles = make(map[string]*ProfileState)
+	}
+}
+
+func (s *State) copy() State {
+	c := State{
+		HashRates: HashRates{
+			Fingerprint: s.HashRates.Fingerprint,
+			History:     make(map[string][]HashRateSample, len(s.HashRates.History)),
+		},
+		Profiles: make(map[string]*ProfileState, len(s.Profiles)),
+	}
+	for n, samples := range s.HashRates.History {
+		c.HashRates.History[n] = append([]HashRateSample(nil), samples...)
+	}
+	for name, p := range s.Profiles {
+		profile := *p
+		profile.LastEndpoints = make(map[string]string, len(p.LastEndpoints))
+		for id, endpoint := range p.LastEndpoints {
+			profile.LastEndpoints[id] = endpoint
+		}
+		c.Profiles[name] = &profile
+	}
+	return c
+}
+
+// reset forgets the loaded state, for tests
+func reset() {
+	mux.Lock()
+	defer mux.Unlock()
+	current = nil
+}
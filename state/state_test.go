@@ -0,0 +1,54 @@
+package state
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestState(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "state")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state.json")
+	os.Setenv(PathEnv, path)
+	defer os.Unsetenv(PathEnv)
+
+	migrations = []func(*State){func(s *State) { s.Profile("production").JWT = "legacy" }}
+	defer func() { migrations = nil }()
+	reset()
+
+	// A new state is seeded from the config file and saved
+	require.Equal("legacy", Get().Profiles["production"].JWT)
+	info, err := os.Stat(path)
+	require.NoError(err)
+	require.Equal(os.FileMode(0600), info.Mode().Perm())
+
+	err = Update(func(s *State) {
+		s.Profile("production").JWT = "fresh"
+		s.HashRates.History["2"] = []HashRateSample{{Time: 1, HashRate: 10000, Duration: 60}}
+	})
+	require.NoError(err)
+	_, err = os.Stat(path + ".tmp")
+	require.True(os.IsNotExist(err))
+
+	// The existing state isn't migrated again
+	reset()
+	s := Get()
+	require.Equal("fresh", s.Profiles["production"].JWT)
+	require.Equal(int64(10000), s.HashRates.History["2"][0].HashRate)
+
+	// Copies don't alter the state
+	s.HashRates.History["2"][0].HashRate = 0
+	require.Equal(int64(10000), Get().HashRates.History["2"][0].HashRate)
+
+	// The state is kept in memory when it cannot be saved
+	os.Setenv(PathEnv, filepath.Join(dir, "missing", "state.json"))
+	require.Error(Update(func(s *State) { s.Profile("production").JWT = "memory" }))
+	require.Equal("memory", Get().Profiles["production"].JWT)
+}
@@ -0,0 +1,170 @@
+package trace
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.com/oraxpool/orax-cli/common"
+	"gitlab.com/oraxpool/orax-cli/protocol"
+	"gitlab.com/oraxpool/orax-message/msg"
+	"gitlab.com/oraxpool/orax-message/msg/fbs"
+)
+
+var log = common.GetLog()
+
+// Frames carrying many nonces exceed the default line size of bufio.Scanner
+const maxFrameSize = 16 * 1024 * 1024
+
+type Direction string
+
+const (
+	Inbound  Direction = "in"
+	Outbound Direction = "out"
+	// Connection events, Connect carries the handshake response headers
+	Connect    Direction = "connect"
+	Disconnect Direction = "disconnect"
+)
+
+// Frame is an entry of a protocol trace
+type Frame struct {
+	Time      time.Time              `json:"t"`
+	Miner     string                 `json:"m,omitempty"`
+	Direction Direction              `json:"d"`
+	Type      string                 `json:"type,omitempty"`
+	Fields    map[string]interface{} `json:"f,omitempty"`
+	Raw       []byte                 `json:"raw,omitempty"`
+}
+
+// Recorder writes the frames exchanged with the orchestrator
+// as JSON lines. A nil Recorder records nothing.
+type Recorder struct {
+	mux    sync.Mutex
+	f      *os.File
+	enc    *json.Encoder
+	failed bool
+}
+
+// Create truncates the trace file and returns its recorder
+func Create(path string) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+// Record a websocket frame sent or received by the miner
+func (r *Recorder) Record(miner string, direction Direction, data []byte) {
+	if r == nil {
+		return
+	}
+	msgType, fields := Decode(data)
+	r.write(Frame{Time: time.Now(), Miner: miner, Direction: direction, Type: msgType, Fields: fields, Raw: data})
+}
+
+// Event records a connection event of the miner
+func (r *Recorder) Event(miner string, direction Direction, fields map[string]interface{}) {
+	if r == nil {
+		return
+	}
+	r.write(Frame{Time: time.Now(), Miner: miner, Direction: direction, Fields: fields})
+}
+
+func (r *Recorder) write(frame Frame) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if err := r.enc.Encode(frame); err != nil && !r.failed {
+		r.failed = true
+		log.WithError(err).Error("Failed to record protocol trace")
+	}
+}
+
+func (r *Recorder) Close() error {
+	if r == nil {
+		return nil
+	}
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return r.f.Close()
+}
+
+// Read all the frames of a trace file
+func Read(path string) ([]Frame, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var frames []Frame
+	err = common.ReadJSONLines(f, maxFrameSize, func() interface{} { return new(Frame) }, func(v interface{}) {
+		frames = append(frames, *v.(*Frame))
+	})
+	return frames, err
+}
+
+// Decode returns the type and the fields of a message of the protocol
+func Decode(data []byte) (string, map[string]interface{}) {
+	message, err := protocol.UnmarshalMessage(data)
+	if err != nil {
+		return "Invalid", map[string]interface{}{"error": err.Error()}
+	}
+
+	switch v := message.(type) {
+	case *fbs.StartMiningMessage:
+		return "StartMining", map[string]interface{}{"oprHash": hex.EncodeToString(v.OprHashBytes())}
+	case *fbs.SubmissionWindowClosingMessage:
+		return "SubmissionWindowClosing", map[string]interface{}{"deadline": v.Deadline()}
+	case *fbs.SetTargetMessage:
+		return "SetTarget", map[string]interface{}{"target": fmt.Sprintf("%016x", v.Target())}
+	case *fbs.SubmitMessage:
+		return "Submit", map[string]interface{}{"nonces": v.NoncesLength()}
+	case *protocol.SubmitAckMessage:
+		return "SubmitAck", jsonFields(v)
+	case *protocol.PauseMessage:
+		return "Pause", jsonFields(v)
+	case *protocol.ResumeMessage:
+		return "Resume", nil
+	case *protocol.ReconnectMessage:
+		return "Reconnect", jsonFields(v)
+	case *protocol.ShutdownMessage:
+		return "Shutdown", jsonFields(v)
+	default:
+		// Messages of the first version of the protocol
+		return strings.TrimSuffix(strings.TrimPrefix(fmt.Sprintf("%T", v), "*msg."), "Message"), nil
+	}
+}
+
+// jsonFields returns the fields of a JSON encoded message
+func jsonFields(message interface{}) map[string]interface{} {
+	var fields map[string]interface{}
+	raw, _ := json.Marshal(message)
+	json.Unmarshal(raw, &fields)
+	return fields
+}
+
+// Nonces returns the nonces of a submit message
+func Nonces(data []byte) [][]byte {
+	message, err := msg.UnmarshalMessage(data)
+	if err != nil {
+		return nil
+	}
+	submit, ok := message.(*fbs.SubmitMessage)
+	if !ok {
+		return nil
+	}
+
+	nonces := make([][]byte, submit.NoncesLength())
+	nonce := new(fbs.Nonce)
+	for i := range nonces {
+		submit.Nonces(nonce, i)
+		nonces[i] = nonce.BytesBytes()
+	}
+	return nonces
+}
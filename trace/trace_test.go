@@ -0,0 +1,53 @@
+package trace
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	flatbuffers "github.com/google/flatbuffers/go"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/oraxpool/orax-message/msg"
+)
+
+func TestRecorder(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "trace")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "trace.jsonl")
+
+	recorder, err := Create(path)
+	require.NoError(err)
+
+	builder := flatbuffers.NewBuilder(1024)
+	nonces := [][]byte{{1, 2, 3}, {4, 5, 6}}
+	recorder.Event("rig", Connect, map[string]interface{}{"headers": map[string]interface{}{"Target": "42"}})
+	recorder.Record("rig", Inbound, msg.NewSetTargetMessage(builder, 0xffff000000000000))
+	recorder.Record("rig", Outbound, msg.NewSubmitMessage(builder, nonces))
+	recorder.Record("rig", Inbound, []byte{255, 0})
+	require.NoError(recorder.Close())
+
+	// A nil recorder is disabled
+	var disabled *Recorder
+	disabled.Record("rig", Inbound, nil)
+
+	frames, err := Read(path)
+	require.NoError(err)
+	require.Len(frames, 4)
+
+	require.Equal(Connect, frames[0].Direction)
+	require.Equal("42", frames[0].Fields["headers"].(map[string]interface{})["Target"])
+
+	require.Equal("SetTarget", frames[1].Type)
+	require.Equal("ffff000000000000", frames[1].Fields["target"])
+
+	require.Equal(Outbound, frames[2].Direction)
+	require.Equal("Submit", frames[2].Type)
+	require.Equal(float64(2), frames[2].Fields["nonces"])
+	require.Equal(nonces, Nonces(frames[2].Raw))
+
+	require.Equal("Invalid", frames[3].Type)
+}
@@ -2,20 +2,27 @@ package ws
 
 import (
 	"context"
+	"encoding/binary"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
-	"net/url"
-	"os"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"gitlab.com/oraxpool/orax-cli/common"
+	"gitlab.com/oraxpool/orax-cli/config"
+	"gitlab.com/oraxpool/orax-cli/protocol"
+	"gitlab.com/oraxpool/orax-cli/trace"
 
 	"github.com/cenkalti/backoff"
 	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
 
@@ -25,7 +32,16 @@ var (
 
 const (
 	redirectDurationLimit = 5 * time.Minute
-	pingInterval          = 45 * time.Second
+	// Smaller messages aren't worth compressing
+	defaultCompressionThreshold = 256
+)
+
+// Variables to be shortened by tests
+var (
+	pingInterval = 45 * time.Second
+	// A connection without any pong or message for
+	// this long is considered dead
+	pongWait = pingInterval + 15*time.Second
 )
 
 func exponentialBackOff() *backoff.ExponentialBackOff {
@@ -45,52 +61,113 @@ type Client struct {
 	id          string
 	NbSubMiners int
 	Endpoint    string
+	// Identity of the miner, default to the one of the active profile
+	MinerID     string
+	MinerSecret string
+	// Name of the client in the protocol traces
+	Name   string
+	Logger *logrus.Entry
+	// Hash rate reported to the server at each connection,
+	// default to the indicative hash rate saved in the config
+	HashRate func() int64
+	// Records the frames exchanged with the orchestrator, nil to disable
+	Trace *trace.Recorder
+	// Negotiate permessage-deflate and compress the messages
+	// of at least CompressionThreshold bytes
+	Compression          bool
+	CompressionThreshold int
+
+	defaultEndpoint string
+	// Endpoint of the previous run, given a single attempt
+	lastEndpoint string
+	// Reason the client gave up connecting
+	err error
 
 	Send    chan []byte
 	Receive chan []byte
+	// Called once each message of Send is written, with its number on
+	// the connection starting from 1, or with the error of the write
+	Sent func(seq int64, err error)
 
 	Connected    chan *ConnectionInfo
 	Disconnected chan bool
+
+	reconnect chan reconnectRequest
+	flush     chan chan struct{}
+
+	statsMux sync.Mutex
+	stats    ConnectionStats
+	wire     *wireCounter
 }
 
+// ConnectionStats describe the health of the current connection
+type ConnectionStats struct {
+	// Round-trip time measured with the latest ping
+	Latency  time.Duration
+	LastPong time.Time
+	// Size of the messages exchanged, and of the bytes
+	// transferred once compressed and framed
+	BytesSent         int64
+	BytesReceived     int64
+	WireBytesSent     int64
+	WireBytesReceived int64
+}
+
+type reconnectRequest struct {
+	endpoint string
+	delay    time.Duration
+}
+
+// Headers of the handshake response recorded in protocol traces
+var connectionHeaders = []string{"NoncePrefix", "Target", "BatchingDuration", "InitialBatchDelay", "Protocol-Features"}
+
 type ConnectionInfo struct {
+	Endpoint          string
 	NoncePrefix       []byte
 	Target            uint64
 	BatchingDuration  time.Duration
 	InitialBatchDelay time.Duration
-}
-
-var orchestratorURL string
-
-func init() {
-	// Override endpoint with env variable
-	if os.Getenv("ORAX_ORCHESTRATOR_ENDPOINT") != "" {
-		_, err := url.ParseRequestURI(os.Getenv("ORAX_ORCHESTRATOR_ENDPOINT"))
-		if err != nil {
-			log.Fatalf("Failed to parse ORAX_ORCHESTRATOR_ENDPOINT: %s", err)
-		}
-		orchestratorURL = os.Getenv("ORAX_ORCHESTRATOR_ENDPOINT")
-	} else if orchestratorURL == "" {
-		// If not set at build time fallback to local dev endpoint
-		orchestratorURL = "ws://localhost:8077/miner"
-	}
+	// Features of the protocol enabled by the orchestrator
+	Features map[string]bool
+	// Permessage-deflate accepted by the orchestrator
+	Compression bool
 }
 
 func NewWebSocketClient(nbSubMiners int) (cli *Client) {
 	cli = new(Client)
-	cli.Endpoint = orchestratorURL
+	cli.Endpoint = config.OrchestratorEndpoint()
 	cli.NbSubMiners = nbSubMiners
+	cli.Logger = logrus.NewEntry(log)
+	cli.MinerID = config.GetString("miner_id")
+	if secret, err := config.GetSecret("miner_secret"); err == nil {
+		cli.MinerSecret = secret
+	}
+	cli.HashRate = func() int64 {
+		return common.GetIndicativeHashRate(nbSubMiners)
+	}
+	cli.Compression = !config.IsSet("compression") || viper.GetBool(config.Path("compression"))
+	cli.CompressionThreshold = defaultCompressionThreshold
+	if config.IsSet("compression_threshold") {
+		cli.CompressionThreshold = viper.GetInt(config.Path("compression_threshold"))
+	}
 
 	cli.Connected = make(chan *ConnectionInfo)
 	cli.Disconnected = make(chan bool)
 	cli.Receive = make(chan []byte)
 	cli.Send = make(chan []byte, 2)
+	cli.reconnect = make(chan reconnectRequest, 1)
+	cli.flush = make(chan chan struct{})
 
 	return cli
 }
 
 func (cli *Client) Start(stop <-chan struct{}) <-chan struct{} {
 	done := make(chan struct{})
+	cli.defaultEndpoint = cli.Endpoint
+	// Connect straight to the orchestrator the miner was redirected to
+	if cli.lastEndpoint = config.LastEndpoint(cli.MinerID); cli.lastEndpoint != "" {
+		cli.Endpoint = cli.lastEndpoint
+	}
 
 	go func() {
 		defer func() {
@@ -101,7 +178,10 @@ func (cli *Client) Start(stop <-chan struct{}) <-chan struct{} {
 			close(done)
 		}()
 
-		conn := cli.connect(stop)
+		conn, err := cli.connect(stop)
+		if err != nil {
+			return
+		}
 		doneReading := cli.readPump(conn)
 		stopWrite := make(chan struct{})
 		cli.writePump(conn, stopWrite)
@@ -109,12 +189,16 @@ func (cli *Client) Start(stop <-chan struct{}) <-chan struct{} {
 		for {
 			select {
 			case err := <-doneReading:
+				cli.traceDisconnect(err)
+				cli.logConnectionStats()
 				cli.Disconnected <- true
 				close(stopWrite)
 				conn.Close()
 
 				if err != nil {
-					conn = cli.connect(stop)
+					if conn, err = cli.connect(stop); err != nil {
+						return
+					}
 					doneReading = cli.readPump(conn)
 					stopWrite = make(chan struct{})
 					cli.writePump(conn, stopWrite)
@@ -122,6 +206,32 @@ func (cli *Client) Start(stop <-chan struct{}) <-chan struct{} {
 					// Graceful shutdown initiated by the server
 					return
 				}
+			case r := <-cli.reconnect:
+				// Messages queued before the request belong to this connection
+				flushed := make(chan struct{})
+				cli.flush <- flushed
+				<-flushed
+				cli.closeGracefully(conn, "Reconnecting", doneReading)
+				close(stopWrite)
+				conn.Close()
+				cli.traceDisconnect(nil)
+				cli.logConnectionStats()
+				cli.Disconnected <- true
+
+				select {
+				case <-time.After(r.delay):
+				case <-stop:
+					return
+				}
+				if r.endpoint != "" {
+					cli.Endpoint = r.endpoint
+				}
+				if conn, err = cli.connect(stop); err != nil {
+					return
+				}
+				doneReading = cli.readPump(conn)
+				stopWrite = make(chan struct{})
+				cli.writePump(conn, stopWrite)
 			case <-stop:
 				// Initiate graceful shutdown
 				err := conn.WriteControl(
@@ -131,7 +241,7 @@ func (cli *Client) Start(stop <-chan struct{}) <-chan struct{} {
 				)
 				close(stopWrite)
 				if err != nil {
-					log.WithError(err).Error("Failed to gracefully disconnect")
+					cli.Logger.WithError(err).Error("Failed to gracefully disconnect")
 					return
 				}
 
@@ -141,6 +251,8 @@ func (cli *Client) Start(stop <-chan struct{}) <-chan struct{} {
 				case <-doneReading:
 				case <-time.After(2 * time.Second):
 				}
+				cli.traceDisconnect(nil)
+				cli.logConnectionStats()
 				return
 			}
 		}
@@ -149,16 +261,45 @@ func (cli *Client) Start(stop <-chan struct{}) <-chan struct{} {
 	return done
 }
 
-func (cli *Client) connect(stop <-chan struct{}) (conn *websocket.Conn) {
-	id := viper.GetString("miner_id")
-	minerSecret := viper.GetString("miner_secret")
-	log.Infof("Connecting to Orax as [%s]...", id)
+// Reconnect closes the connection and connects again after the delay,
+// to the endpoint if not empty. Unreachable endpoints are given up after
+// a while as redirections.
+func (cli *Client) Reconnect(endpoint string, delay time.Duration) {
+	select {
+	case cli.reconnect <- reconnectRequest{endpoint: endpoint, delay: delay}:
+	default:
+		// A reconnection is already pending
+	}
+}
 
-	header := http.Header{
-		"Authorization": []string{id + ":" + minerSecret},
-		"Version":       []string{common.Version[1:]},
-		"HashRate":      []string{strconv.FormatInt(common.GetIndicativeHashRate(cli.NbSubMiners), 10)},
+// closeGracefully sends a close message and waits
+// for the server to close the connection or a timeout
+func (cli *Client) closeGracefully(conn *websocket.Conn, reason string, doneReading <-chan error) {
+	err := conn.WriteControl(
+		websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, reason),
+		time.Now().Add(10*time.Second),
+	)
+	if err != nil {
+		cli.Logger.WithError(err).Error("Failed to gracefully disconnect")
+		return
+	}
+	select {
+	case <-doneReading:
+	case <-time.After(2 * time.Second):
 	}
+}
+
+// Err returns the reason the client gave up connecting once it is done,
+// nil if it was stopped or the server closed the connection
+func (cli *Client) Err() error {
+	return cli.err
+}
+
+// connect retries until connected, stopped or the
+// orchestrator rejects the miner and returns the error
+func (cli *Client) connect(stop <-chan struct{}) (conn *websocket.Conn, err error) {
+	cli.Logger.Infof("Connecting to Orax as [%s]...", cli.MinerID)
 
 	var connectionInfo *ConnectionInfo
 	ctx, cancel := context.WithCancel(context.Background())
@@ -175,19 +316,32 @@ func (cli *Client) connect(stop <-chan struct{}) (conn *websocket.Conn) {
 		}
 	}()
 
-	err := backoff.RetryNotify(func() error {
+	err = backoff.RetryNotify(func() error {
 		// If a redirection didn't allow the client to connect after a certain amount of time
 		// reset the endpoint to the default
 		// This prevents the client to be stuck for ever because of a faulty redirection
-		if cli.Endpoint != orchestratorURL && retryStrategy.GetElapsedTime() > redirectDurationLimit {
-			cli.Endpoint = orchestratorURL
+		if cli.Endpoint != cli.defaultEndpoint && retryStrategy.GetElapsedTime() > redirectDurationLimit {
+			cli.Endpoint = cli.defaultEndpoint
 			retryWithContext.Reset()
-			log.Warnf("Resetting endpoint to the default [%s]", cli.Endpoint)
+			cli.Logger.Warnf("Resetting endpoint to the default [%s]", cli.Endpoint)
 		}
 
+		// The hash rate is evaluated at each attempt as it evolves while mining
+		header := http.Header{
+			"Authorization": []string{cli.MinerID + ":" + cli.MinerSecret},
+			"Version":       []string{common.Version[1:]},
+			"HashRate":      []string{strconv.FormatInt(cli.HashRate(), 10)},
+			// Capabilities of the client, older orchestrators ignore them
+			"Protocol-Messages": []string{protocol.FormatMessageTypes(protocol.MessageTypes)},
+			"Protocol-Features": []string{strings.Join(protocol.Features, ",")},
+		}
+
+		wire := new(wireCounter)
 		d := websocket.Dialer{
-			Proxy:            http.ProxyFromEnvironment,
-			HandshakeTimeout: 45 * time.Second}
+			Proxy:             http.ProxyFromEnvironment,
+			NetDialContext:    dialCounting(wire),
+			HandshakeTimeout:  45 * time.Second,
+			EnableCompression: cli.Compression}
 		c, resp, err := d.Dial(cli.Endpoint, header)
 
 		if err != nil {
@@ -246,20 +400,59 @@ func (cli *Client) connect(stop <-chan struct{}) (conn *websocket.Conn) {
 			return err
 		}
 
+		connectionInfo.Endpoint = cli.Endpoint
 		conn = c
+		cli.statsMux.Lock()
+		cli.wire = wire
+		cli.statsMux.Unlock()
+
+		headers := make(map[string]interface{})
+		for _, name := range connectionHeaders {
+			if value := resp.Header.Get(name); value != "" {
+				headers[name] = value
+			}
+		}
+		cli.Trace.Event(cli.Name, trace.Connect, map[string]interface{}{"endpoint": cli.Endpoint, "headers": headers})
 
 		return nil
 	}, retryWithContext, func(err error, duration time.Duration) {
-		log.Warnf("Failed to connect. Retrying in %s", duration)
+		cli.Logger.Warnf("Failed to connect. Retrying in %s", duration)
+		if cli.lastEndpoint != "" && cli.Endpoint == cli.lastEndpoint {
+			cli.Endpoint = cli.defaultEndpoint
+			cli.Logger.Warnf("Resetting endpoint to the default [%s]", cli.Endpoint)
+		}
+		cli.lastEndpoint = ""
 	})
 	close(backoffOver)
 
 	if err != nil {
-		log.WithError(err).Fatal("Failed to connect")
+		select {
+		case <-stop:
+		default:
+			cli.err = err
+			cli.Logger.WithError(err).Error("Failed to connect, run `orax-cli doctor` to check the configuration")
+		}
+		return nil, err
+	}
+
+	lastEndpoint := connectionInfo.Endpoint
+	if lastEndpoint == cli.defaultEndpoint {
+		lastEndpoint = ""
+	}
+	if err := config.SaveLastEndpoint(cli.MinerID, lastEndpoint); err != nil {
+		cli.Logger.WithError(err).Warn("Failed to save the orchestrator endpoint")
 	}
 
 	cli.Connected <- connectionInfo
-	return conn
+	return conn, nil
+}
+
+func (cli *Client) traceDisconnect(err error) {
+	fields := map[string]interface{}{}
+	if err != nil {
+		fields["error"] = err.Error()
+	}
+	cli.Trace.Event(cli.Name, trace.Disconnect, fields)
 }
 
 func parseConnectionHeaders(header http.Header) (*ConnectionInfo, error) {
@@ -304,11 +497,68 @@ func parseConnectionHeaders(header http.Header) (*ConnectionInfo, error) {
 		}
 	}
 
+	// Older orchestrators don't enable any feature
+	connectionInfo.Features = protocol.ParseFeatures(header.Get("Protocol-Features"))
+	connectionInfo.Compression = strings.Contains(header.Get("Sec-Websocket-Extensions"), "permessage-deflate")
+
 	return connectionInfo, nil
 }
 
+// Stats returns the health of the current connection
+func (cli *Client) Stats() ConnectionStats {
+	cli.statsMux.Lock()
+	defer cli.statsMux.Unlock()
+	stats := cli.stats
+	if cli.wire != nil {
+		stats.WireBytesSent = atomic.LoadInt64(&cli.wire.sent)
+		stats.WireBytesReceived = atomic.LoadInt64(&cli.wire.received)
+	}
+	return stats
+}
+
+func (cli *Client) logConnectionStats() {
+	stats := cli.Stats()
+	cli.Logger.WithFields(logrus.Fields{
+		"bytesSent":         stats.BytesSent,
+		"wireBytesSent":     stats.WireBytesSent,
+		"bytesReceived":     stats.BytesReceived,
+		"wireBytesReceived": stats.WireBytesReceived,
+	}).Info("Connection closed")
+}
+
+// recordPong measures the round-trip time of the ping
+// with the timestamp it carries
+func (cli *Client) recordPong(data []byte) {
+	if len(data) != 8 {
+		return
+	}
+	sent := time.Unix(0, int64(binary.BigEndian.Uint64(data)))
+
+	now := time.Now()
+	cli.statsMux.Lock()
+	cli.stats.LastPong = now
+	cli.stats.Latency = now.Sub(sent)
+	cli.statsMux.Unlock()
+
+	cli.Logger.WithField("latency", now.Sub(sent)).Debug("Pong received")
+}
+
 func (cli *Client) readPump(conn *websocket.Conn) (doneReading chan error) {
-	doneReading = make(chan error)
+	// Buffered for the pump to exit when nobody waits for it anymore
+	doneReading = make(chan error, 1)
+
+	cli.statsMux.Lock()
+	cli.stats = ConnectionStats{}
+	cli.statsMux.Unlock()
+
+	// Pongs and messages prove the connection is alive,
+	// a half-open one times out
+	wait := pongWait
+	conn.SetReadDeadline(time.Now().Add(wait))
+	conn.SetPongHandler(func(data string) error {
+		cli.recordPong([]byte(data))
+		return conn.SetReadDeadline(time.Now().Add(wait))
+	})
 
 	go func() {
 		defer close(doneReading)
@@ -320,15 +570,23 @@ func (cli *Client) readPump(conn *websocket.Conn) (doneReading chan error) {
 				// Graceful disconnection
 				if e, ok := err.(*websocket.CloseError); ok && e.Code == websocket.CloseNormalClosure {
 					if e.Text != "" {
-						log.Infof("Disconnection reason: %s", e.Text)
+						cli.Logger.Infof("Disconnection reason: %s", e.Text)
 					}
+				} else if e, ok := err.(net.Error); ok && e.Timeout() {
+					cli.Logger.Errorf("No response from the server for %s, reconnecting", wait)
+					doneReading <- err
 				} else {
-					log.WithError(err).Error("Unexpected error reading from server")
+					cli.Logger.WithError(err).Error("Unexpected error reading from server")
 					doneReading <- err
 				}
 				return
 			}
+			conn.SetReadDeadline(time.Now().Add(wait))
+			cli.statsMux.Lock()
+			cli.stats.BytesReceived += int64(len(message))
+			cli.statsMux.Unlock()
 			if len(message) > 0 {
+				cli.Trace.Record(cli.Name, trace.Inbound, message)
 				cli.Receive <- message
 			}
 		}
@@ -338,13 +596,31 @@ func (cli *Client) readPump(conn *websocket.Conn) (doneReading chan error) {
 }
 
 func (cli *Client) writePump(conn *websocket.Conn, stopWrite chan struct{}) {
+	keepAliveTicker := time.NewTicker(pingInterval)
 	go func() {
-		keepAliveTicker := time.NewTicker(pingInterval)
-
 		defer func() {
 			keepAliveTicker.Stop()
 		}()
 
+		var seq int64
+		write := func(msg []byte) {
+			// Noop unless the compression was negotiated
+			conn.EnableWriteCompression(cli.Compression && len(msg) >= cli.CompressionThreshold)
+			err := conn.WriteMessage(websocket.BinaryMessage, msg)
+			if err != nil {
+				cli.Logger.WithError(err).Error("Failed to send.")
+			} else {
+				seq++
+				cli.statsMux.Lock()
+				cli.stats.BytesSent += int64(len(msg))
+				cli.statsMux.Unlock()
+				cli.Trace.Record(cli.Name, trace.Outbound, msg)
+			}
+			if cli.Sent != nil {
+				cli.Sent(seq, err)
+			}
+		}
+
 		for {
 			select {
 			case <-stopWrite:
@@ -353,14 +629,19 @@ func (cli *Client) writePump(conn *websocket.Conn, stopWrite chan struct{}) {
 				if !ok {
 					return
 				}
-				err := conn.WriteMessage(websocket.BinaryMessage, msg)
-				if err != nil {
-					log.WithError(err).Error("Failed to send.")
+				write(msg)
+			case flushed := <-cli.flush:
+				for len(cli.Send) > 0 {
+					write(<-cli.Send)
 				}
+				close(flushed)
 
 			case <-keepAliveTicker.C:
-				if err := conn.WriteControl(websocket.PingMessage, []byte{}, time.Now().Add(15*time.Second)); err != nil {
-					log.WithError(err).Error("Failed to ping server")
+				// The pong returns the timestamp to measure the latency
+				timestamp := make([]byte, 8)
+				binary.BigEndian.PutUint64(timestamp, uint64(time.Now().UnixNano()))
+				if err := conn.WriteControl(websocket.PingMessage, timestamp, time.Now().Add(15*time.Second)); err != nil {
+					cli.Logger.WithError(err).Error("Failed to ping server")
 				}
 			}
 		}
@@ -0,0 +1,157 @@
+package ws
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPongTracking(t *testing.T) {
+	require := require.New(t)
+
+	defer func(interval, wait time.Duration) {
+		pingInterval, pongWait = interval, wait
+	}(pingInterval, pongWait)
+	pingInterval = 50 * time.Millisecond
+	pongWait = 200 * time.Millisecond
+
+	// The first connection answers the pings for a while, then both
+	// connections go silent without being closed
+	var connections int32
+	var upgrader websocket.Upgrader
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := http.Header{"Nonceprefix": []string{"ab"}, "Target": []string{"42"}}
+		conn, err := upgrader.Upgrade(w, r, header)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if atomic.AddInt32(&connections, 1) == 1 {
+			conn.SetReadDeadline(time.Now().Add(4 * pingInterval))
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					break
+				}
+			}
+		}
+		time.Sleep(time.Second)
+	}))
+	defer server.Close()
+
+	cli := NewWebSocketClient(1)
+	cli.Endpoint = "ws" + strings.TrimPrefix(server.URL, "http")
+	cli.HashRate = func() int64 { return 0 }
+	stop := make(chan struct{})
+	done := cli.Start(stop)
+
+	<-cli.Connected
+	time.Sleep(3 * pingInterval)
+	stats := cli.Stats()
+	require.True(stats.Latency > 0)
+	require.WithinDuration(time.Now(), stats.LastPong, 2*pingInterval)
+
+	// The dead connection is detected and replaced
+	go func() {
+		for range cli.Receive {
+		}
+	}()
+	require.True(<-cli.Disconnected)
+	<-cli.Connected
+	time.Sleep(pingInterval)
+	require.Zero(cli.Stats().Latency)
+	require.True(<-cli.Disconnected)
+
+	close(stop)
+	go func() {
+		for range cli.Connected {
+		}
+	}()
+	go func() {
+		for range cli.Disconnected {
+		}
+	}()
+	<-done
+}
+
+func TestCompression(t *testing.T) {
+	require := require.New(t)
+
+	received := make(chan []byte)
+	upgrader := websocket.Upgrader{EnableCompression: true}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := http.Header{"Nonceprefix": []string{"ab"}, "Target": []string{"42"}}
+		conn, err := upgrader.Upgrade(w, r, header)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			_, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			received <- message
+		}
+	}))
+	defer server.Close()
+
+	cli := NewWebSocketClient(1)
+	cli.Endpoint = "ws" + strings.TrimPrefix(server.URL, "http")
+	cli.HashRate = func() int64 { return 0 }
+	stop := make(chan struct{})
+	done := cli.Start(stop)
+
+	require.True((<-cli.Connected).Compression)
+	wireSent := cli.Stats().WireBytesSent
+	require.True(wireSent > 0)
+
+	// Nonces compress well
+	cli.Send <- make([]byte, 10000)
+	require.Len(<-received, 10000)
+	stats := cli.Stats()
+	require.Equal(int64(10000), stats.BytesSent)
+	require.True(stats.WireBytesSent-wireSent < 1000)
+
+	// Small messages are sent as is, framed with a 2 bytes
+	// header and the 4 bytes mask of the client
+	cli.Send <- []byte{1, 2, 3}
+	require.Equal([]byte{1, 2, 3}, <-received)
+	require.Equal(int64(10003), cli.Stats().BytesSent)
+	require.Equal(stats.WireBytesSent+2+4+3, cli.Stats().WireBytesSent)
+
+	close(stop)
+	go func() {
+		for range cli.Disconnected {
+		}
+	}()
+	<-done
+}
+
+func TestConnectRejected(t *testing.T) {
+	require := require.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	cli := NewWebSocketClient(1)
+	cli.Endpoint = "ws" + strings.TrimPrefix(server.URL, "http")
+	cli.HashRate = func() int64 { return 0 }
+	stop := make(chan struct{})
+	defer close(stop)
+
+	// The client stops instead of exiting the process
+	select {
+	case <-cli.Start(stop):
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the client to stop")
+	}
+	require.EqualError(cli.Err(), "Failed to authenticate with orax orchestrator")
+}
@@ -0,0 +1,44 @@
+package ws
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+)
+
+// wireCounter counts the bytes transferred on a connection
+// once compressed and framed, handshake included
+type wireCounter struct {
+	sent     int64
+	received int64
+}
+
+type countingConn struct {
+	net.Conn
+	counter *wireCounter
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	atomic.AddInt64(&c.counter.received, int64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	atomic.AddInt64(&c.counter.sent, int64(n))
+	return n, err
+}
+
+// dialCounting returns a dial function counting the bytes of
+// the connections it opens, TLS and proxy ones included
+func dialCounting(counter *wireCounter) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return &countingConn{Conn: conn, counter: counter}, nil
+	}
+}